@@ -278,11 +278,17 @@ var stopWords = map[string]bool{
 	"let": true, "use": true,
 }
 
+// Standard BM25 parameters, shared by snippet scoring and keyword search
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
 // bm25Score computes BM25 scores for each document given query tokens.
 // Uses standard parameters: k1=1.2, b=0.75
 func bm25Score(docs [][]string, query []string) []float64 {
-	k1 := 1.2
-	b := 0.75
+	k1 := bm25K1
+	b := bm25B
 	n := len(docs)
 
 	// Average document length
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// boolTermMatches caps the messages shown per term per session; a
+// session qualifies on the first hit, the rest only add noise.
+const boolTermMatches = 3
+
+// boolQuery is a session-scoped query like "deploy AND rollback NOT
+// staging": a session matches when every required clause matches some
+// message in it and no excluded term matches any. Each term is a regex
+// evaluated per message, so terms may come from different messages.
+type boolQuery struct {
+	require [][]boolTerm // AND of clauses; a clause is an OR of terms
+	exclude []boolTerm
+	opts    SearchOpts // matching modes the terms were compiled with
+	without *regexp.Regexp
+}
+
+type boolTerm struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// isBoolQuery reports whether a pattern is written as a boolean query:
+// one with an AND or OR, or a NOT after a term ("deploy NOT staging").
+// Operators must be uppercase and outside double quotes, so regexes like
+// "and|or" are unaffected. A leading NOT ("NOT NULL") and a NOT in an
+// all-uppercase pattern ("IS NOT NULL", "IF NOT EXISTS") stay regexes,
+// as SQL. A query that doesn't parse is an error, not a regex.
+func isBoolQuery(pattern string) bool {
+	sql := pattern == strings.ToUpper(pattern)
+	toks := boolTokens(pattern)
+	for i, t := range toks {
+		if !t.op {
+			continue
+		}
+		if t.word != "NOT" || (!sql && i > 0 && !toks[i-1].op) {
+			return true
+		}
+	}
+	return false
+}
+
+// boolToken is a word of a boolean query; op marks AND, OR and NOT
+// outside double quotes.
+type boolToken struct {
+	word string
+	op   bool
+}
+
+func boolTokens(query string) []boolToken {
+	var toks []boolToken
+	quoted := false
+	for _, w := range strings.Fields(query) {
+		toks = append(toks, boolToken{word: w, op: !quoted && (w == "AND" || w == "OR" || w == "NOT")})
+		if strings.Count(w, `"`)%2 == 1 {
+			quoted = !quoted
+		}
+	}
+	return toks
+}
+
+// parseBoolQuery parses a boolean query. OR binds tighter than AND, and
+// NOT excludes the term after it (with any terms OR-ed onto it). Words
+// between operators form one term: "roll back AND x" has terms "roll
+// back" and "x", and operators inside double quotes are words of a term.
+// Terms compile under the matching modes of opts.
+func parseBoolQuery(query string, opts SearchOpts) (*boolQuery, error) {
+	q := &boolQuery{opts: opts}
+	op := "AND"      // how the next term joins the query
+	negated := false // whether the clause being built is excluded
+	var words []string
+
+	flush := func(next string) error {
+		if len(words) == 0 {
+			if next == "NOT" && op == "AND" {
+				op = next // leading "NOT x" or "x AND NOT y"
+				return nil
+			}
+			return fmt.Errorf("%s needs a term on both sides", next)
+		}
+		pattern := strings.Trim(strings.Join(words, " "), `"`)
+		words = nil
+		re, err := opts.compile(normalizeBRE(pattern))
+		if err != nil {
+			return err
+		}
+		term := boolTerm{pattern: pattern, re: re}
+
+		switch op {
+		case "OR":
+			if negated {
+				q.exclude = append(q.exclude, term)
+			} else {
+				last := len(q.require) - 1
+				q.require[last] = append(q.require[last], term)
+			}
+		case "NOT":
+			negated = true
+			q.exclude = append(q.exclude, term)
+		default:
+			negated = false
+			q.require = append(q.require, []boolTerm{term})
+		}
+		op = next
+		return nil
+	}
+
+	for _, t := range boolTokens(query) {
+		if t.op {
+			if err := flush(t.word); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		words = append(words, t.word)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%s needs a term after it", op)
+	}
+	if err := flush(""); err != nil {
+		return nil, err
+	}
+	if len(q.require) == 0 {
+		return nil, fmt.Errorf("query needs at least one term without NOT")
+	}
+	without, err := opts.withoutRe()
+	if err != nil {
+		return nil, err
+	}
+	q.without = without
+	return q, nil
+}
+
+// terms returns the required term patterns, for display and BM25.
+func (q *boolQuery) terms() []string {
+	var out []string
+	for _, clause := range q.require {
+		for _, t := range clause {
+			out = append(out, t.pattern)
+		}
+	}
+	return out
+}
+
+// prefilterGroups returns one literal group per required clause: a file
+// must contain a literal from each. A clause with a term that has no
+// literal can't be prefiltered and gets an empty group. The literals are
+// exact-case only if every term is case-sensitive.
+func (q *boolQuery) prefilterGroups() (groups [][][]byte, exact bool) {
+	exact = true
+	for _, t := range q.terms() {
+		exact = exact && q.opts.exactCase(normalizeBRE(t))
+	}
+	o := q.opts
+	o.CaseSensitive = exact
+	for _, clause := range q.require {
+		var group [][]byte
+		for _, t := range clause {
+			lits := o.prefilterLiterals(normalizeBRE(t.pattern))
+			if lits == nil {
+				group = nil
+				break
+			}
+			group = append(group, lits...)
+		}
+		groups = append(groups, group)
+	}
+	return groups, exact
+}
+
+// boolSearch evaluates a boolean query per session. It returns up to
+// boolTermMatches messages per required term for each matching session,
+// newest first, with -n capping the number of sessions.
+func boolSearch(q *boolQuery, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
+	files, conversations, err := searchScope(searchPath, opts)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+
+	groups, exact := q.prefilterGroups()
+	candidates, ruledOut := trigramFilter(files, groups)
+	sessions, pfSkipped := searchEach(candidates, func(fp string) ([]Match, bool) {
+		return boolSearchFile(fp, q, groups, exact, opts)
+	})
+	// Sessions with the most recent hit first
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i][0].Message.Timestamp > sessions[j][0].Message.Timestamp
+	})
+	if len(sessions) > opts.MaxResults {
+		sessions = sessions[:opts.MaxResults]
+	}
+
+	var allMatches []Match
+	for _, s := range sessions {
+		for _, m := range s {
+			m.Message.Conversation = conversations[m.Message.FilePath]
+			allMatches = append(allMatches, m)
+		}
+	}
+
+	return allMatches, newSearchStats(len(files), len(ruledOut), pfSkipped), nil
+}
+
+// boolSearchFile evaluates a query against one session file. Matches come
+// back newest first; nil means the session doesn't satisfy the query.
+func boolSearchFile(fpath string, q *boolQuery, groups [][][]byte, exact bool, opts SearchOpts) (matches []Match, prefilterSkipped bool) {
+	messages, skipped := readSession(fpath, groups, exact)
+	if len(messages) == 0 || mentions(messages, q.without) {
+		return nil, skipped
+	}
+
+	// hits[c][t] lists the messages matching term t of required clause c
+	hits := make([][][]int, len(q.require))
+	for c, clause := range q.require {
+		hits[c] = make([][]int, len(clause))
+	}
+	for i, msg := range messages {
+		if !opts.accepts(msg) {
+			continue
+		}
+		for _, t := range q.exclude {
+			if t.re.MatchString(msg.Text) {
+				return nil, false
+			}
+		}
+		for c, clause := range q.require {
+			for ti, t := range clause {
+				if t.re.MatchString(msg.Text) {
+					hits[c][ti] = append(hits[c][ti], i)
+				}
+			}
+		}
+	}
+
+	for _, clause := range hits {
+		found := false
+		for _, h := range clause {
+			found = found || len(h) > 0
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	var t *thread
+	shown := make(map[int]int) // message → its position in matches
+	for c, clause := range hits {
+		for ti, h := range clause {
+			term := q.require[c][ti].pattern
+			// Latest hits of the term, newest first
+			for k := len(h) - 1; k >= 0 && k >= len(h)-boolTermMatches; k-- {
+				if j, ok := shown[h[k]]; ok {
+					matches[j].Term += ", " + term
+					continue
+				}
+				shown[h[k]] = len(matches)
+				msg := messages[h[k]]
+				m := Match{Message: msg, Term: term}
+				if opts.Before > 0 || opts.After > 0 {
+					if t == nil {
+						t = newThread(messages)
+					}
+					m.ContextBefore = t.before(msg.MsgIndex, opts.Before)
+					m.ContextAfter = t.after(msg.MsgIndex, opts.After)
+				}
+				matches = append(matches, m)
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Message.Timestamp > matches[j].Message.Timestamp
+	})
+	return matches, false
+}
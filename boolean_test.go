@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBoolQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		require string // clauses joined by " & ", terms by "|"
+		exclude string
+		wantErr bool
+	}{
+		{"deploy AND rollback", "deploy & rollback", "", false},
+		{"deploy AND rollback NOT staging", "deploy & rollback", "staging", false},
+		{"deploy NOT staging", "deploy", "staging", false},
+		{"deploy AND rollback OR revert", "deploy & rollback|revert", "", false},
+		{"NOT staging AND deploy", "deploy", "staging", false},
+		{"deploy AND NOT staging OR dev", "deploy", "staging|dev", false},
+		{"roll back AND \"db migrate\"", "roll back & db migrate", "", false},
+		{"\"IS NOT NULL\" AND users", "IS NOT NULL & users", "", false},
+		{"deploy AND", "", "", true},
+		{"deploy NOT", "", "", true},
+		{"AND deploy", "", "", true},
+		{"deploy AND AND rollback", "", "", true},
+		{"NOT staging", "", "", true},
+		{"deploy AND (unclosed", "", "", true},
+	}
+	for _, tt := range tests {
+		q, err := parseBoolQuery(tt.query, SearchOpts{})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		var clauses []string
+		for _, c := range q.require {
+			var terms []string
+			for _, term := range c {
+				terms = append(terms, term.pattern)
+			}
+			clauses = append(clauses, strings.Join(terms, "|"))
+		}
+		var excluded []string
+		for _, term := range q.exclude {
+			excluded = append(excluded, term.pattern)
+		}
+		if got := strings.Join(clauses, " & "); got != tt.require {
+			t.Errorf("%q: require = %q, want %q", tt.query, got, tt.require)
+		}
+		if got := strings.Join(excluded, "|"); got != tt.exclude {
+			t.Errorf("%q: exclude = %q, want %q", tt.query, got, tt.exclude)
+		}
+	}
+}
+
+func TestIsBoolQuery(t *testing.T) {
+	for pattern, want := range map[string]bool{
+		"deploy AND rollback": true,
+		"NOT staging AND x":   true,
+		"and|or":              false,
+		"ANDROID build":       false,
+		"deploy rollback":     false,
+		"deploy AND NOT x":    true,
+		"deploy NOT staging":  true,
+		// SQL and log text with no AND/OR between terms stays a regex
+		"NOT NULL":                  false,
+		"IF NOT EXISTS":             false,
+		"IS NOT NULL":               false,
+		"\"IS NOT NULL\" AND users": true,
+		"\"deploy AND rollback\"":   false,
+		// Malformed queries are still queries, reported by parseBoolQuery
+		"deploy AND":           true,
+		"deploy AND (unclosed": true,
+		"deploy NOT":           true,
+	} {
+		if got := isBoolQuery(pattern); got != want {
+			t.Errorf("isBoolQuery(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestPrefilterAllReader(t *testing.T) {
+	// "rollback" straddles the first chunk boundary
+	data := strings.Repeat("x", lineBufSize-4) + "ROLLBACK then deploy"
+	tests := []struct {
+		groups [][]string
+		want   bool
+	}{
+		{[][]string{{"deploy"}, {"rollback"}}, true},
+		{[][]string{{"deploy"}, {"staging", "rollback"}}, true},
+		{[][]string{{"deploy"}, {"staging"}}, false},
+		{[][]string{{"deploy"}, nil}, true},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		var groups [][][]byte
+		for _, g := range tt.groups {
+			var lits [][]byte
+			for _, l := range g {
+				lits = append(lits, []byte(l))
+			}
+			groups = append(groups, lits)
+		}
+		got, err := prefilterAllReader(strings.NewReader(data), groups, false)
+		if err != nil || got != tt.want {
+			t.Errorf("%v: got %v, %v; want %v", tt.groups, got, err, tt.want)
+		}
+	}
+}
+
+func TestBoolSearch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+
+	sessions := map[string]string{
+		// terms in different messages: matches
+		"aaaa": `{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"deploy the api"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-02T10:01:00Z","message":{"content":[{"type":"text","text":"Deployed. Rollback plan is ready."}]}}
+{"type":"user","uuid":"u2","parentUuid":"a1","timestamp":"2025-01-02T10:02:00Z","message":{"content":"we had to rollback"}}
+`,
+		// excluded term
+		"bbbb": `{"type":"user","uuid":"u1","timestamp":"2025-01-03T10:00:00Z","message":{"content":"deploy to staging"}}
+{"type":"user","uuid":"u2","parentUuid":"u1","timestamp":"2025-01-03T10:01:00Z","message":{"content":"rollback"}}
+`,
+		// only one term
+		"cccc": `{"type":"user","uuid":"u1","timestamp":"2025-01-04T10:00:00Z","message":{"content":"deploy it"}}
+`,
+	}
+	for name, data := range sessions {
+		os.WriteFile(filepath.Join(dir, name+".jsonl"), []byte(data), 0644)
+	}
+
+	q, err := parseBoolQuery("deploy AND rollback NOT staging", SearchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, stats, err := boolSearch(q, dir, SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PrefilterSkipped != 1 {
+		t.Errorf("prefilter should skip the session without rollback, skipped %d", stats.PrefilterSkipped)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("got %d matches, want 3: %+v", len(matches), matches)
+	}
+	for _, m := range matches {
+		if m.Message.SessionID != "aaaa" {
+			t.Errorf("unexpected session %s", m.Message.SessionID)
+		}
+	}
+	// Newest first; the assistant message matches both terms
+	want := []string{"rollback", "deploy, rollback", "deploy"}
+	for i, m := range matches {
+		if m.Term != want[i] {
+			t.Errorf("[%d] %q: term %q, want %q", i, m.Message.Text, m.Term, want[i])
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sessionLinks records which session file each message uuid lives in and
+// which sessions were resumed from which, from the summary lines that a
+// continued session opens with.
+type sessionLinks struct {
+	fileOf    map[string]string   // line uuid → session file
+	leaves    map[string][]string // session file → leaf uuids it continues from
+	continues map[string]string   // session file → file it was resumed from
+	next      map[string]string   // session file → file resumed from it
+}
+
+// buildSessionLinks finds which sessions continue which. Only summary
+// lines and lines carrying one of their leaf uuids are decoded, so a
+// project's sessions can be linked without parsing them.
+func buildSessionLinks(files []string) *sessionLinks {
+	l := &sessionLinks{
+		fileOf:    make(map[string]string),
+		leaves:    make(map[string][]string),
+		continues: make(map[string]string),
+		next:      make(map[string]string),
+	}
+	// A resumed session opens with summaries of the one it came from
+	wanted := make(map[string]bool)
+	for _, fpath := range files {
+		l.scanSummaries(fpath)
+		for _, leaf := range l.leaves[fpath] {
+			wanted[leaf] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return l
+	}
+
+	// Find the sessions those leaves were written in
+	owns := make(map[string]map[string]bool)
+	for _, fpath := range files {
+		owns[fpath] = l.scanLeaves(fpath, wanted)
+	}
+	for fpath, leaves := range l.leaves {
+		for _, leaf := range leaves {
+			// A summary of the session's own messages is not a link
+			if owns[fpath][leaf] {
+				continue
+			}
+			if prev, ok := l.fileOf[leaf]; ok && prev != fpath {
+				l.continues[fpath] = prev
+				l.next[prev] = fpath
+				break
+			}
+		}
+	}
+	return l
+}
+
+func (l *sessionLinks) scanSummaries(fpath string) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	readLines(f, func(line []byte) {
+		if !bytes.Contains(line, summaryLit) {
+			return
+		}
+		var sum jsonlSummary
+		if decodeLine(line, &sum) == nil && sum.Type == "summary" && sum.LeafUUID != "" {
+			l.leaves[fpath] = append(l.leaves[fpath], sum.LeafUUID)
+		}
+	})
+}
+
+// scanLeaves records the file of each wanted uuid that fpath's lines
+// carry, and returns those uuids.
+func (l *sessionLinks) scanLeaves(fpath string, wanted map[string]bool) map[string]bool {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	own := make(map[string]bool)
+	readLines(f, func(line []byte) {
+		if !slices.ContainsFunc(uuidValues(line), func(v string) bool { return wanted[v] }) {
+			return
+		}
+		// The uuid may be nested (tool input, progress data): decode to
+		// check it is the line's own
+		var link jsonlLink
+		if decodeLine(line, &link) == nil && wanted[link.UUID] {
+			own[link.UUID] = true
+			// Resumed sessions may copy earlier lines; the first file wins
+			if _, ok := l.fileOf[link.UUID]; !ok {
+				l.fileOf[link.UUID] = fpath
+			}
+		}
+	})
+	return own
+}
+
+// uuidValues returns the string values of every "uuid" key in a line,
+// at any depth, without decoding it.
+func uuidValues(line []byte) []string {
+	var vals []string
+	for i := bytes.Index(line, uuidLit); i >= 0; {
+		rest := bytes.TrimLeft(line[i+len(uuidLit):], " ")
+		if rest, ok := bytes.CutPrefix(rest, []byte(":")); ok {
+			rest = bytes.TrimLeft(rest, " ")
+			if rest, ok := bytes.CutPrefix(rest, []byte(`"`)); ok {
+				if end := bytes.IndexByte(rest, '"'); end >= 0 {
+					vals = append(vals, string(rest[:end]))
+				}
+			}
+		}
+		line = line[i+len(uuidLit):]
+		i = bytes.Index(line, uuidLit)
+	}
+	return vals
+}
+
+// chain returns the sessions of fpath's logical conversation, oldest first.
+func (l *sessionLinks) chain(fpath string) []string {
+	root := fpath
+	seen := map[string]bool{root: true}
+	for {
+		prev, ok := l.continues[root]
+		if !ok || seen[prev] {
+			break
+		}
+		seen[prev] = true
+		root = prev
+	}
+
+	out := []string{root}
+	for f := l.next[root]; f != "" && !slices.Contains(out, f); f = l.next[f] {
+		out = append(out, f)
+	}
+	return out
+}
+
+// expandContinuations adds the other sessions of every resumed chain that
+// files touches, except exclude, and maps each file to the session ID of
+// its chain's first session. Chains stay within a project directory, so
+// only the directories files are in are scanned.
+func expandContinuations(files []string, exclude string) ([]string, map[string]string) {
+	var all []string
+	seenDir := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		if seenDir[dir] {
+			continue
+		}
+		seenDir[dir] = true
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+				all = append(all, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	links := buildSessionLinks(all)
+
+	conversations := make(map[string]string)
+	inScope := make(map[string]bool)
+	for _, f := range files {
+		inScope[f] = true
+	}
+	expanded := files
+	for _, f := range files {
+		chain := links.chain(f)
+		if len(chain) < 2 {
+			continue
+		}
+		root := extractSessionID(chain[0])
+		for _, c := range chain {
+			conversations[c] = root
+			if !inScope[c] && c != exclude {
+				inScope[c] = true
+				expanded = append(expanded, c)
+			}
+		}
+	}
+	return expanded, conversations
+}
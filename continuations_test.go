@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpandContinuations(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	write := func(name, data string, age time.Duration) string {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(data), 0644)
+		mt := time.Now().Add(-age)
+		os.Chtimes(p, mt, mt)
+		return p
+	}
+
+	first := write("first.jsonl", `{"type":"user","uuid":"a1","timestamp":"2025-01-01T10:00:00Z","message":{"content":"start the deploy work"}}
+{"type":"assistant","uuid":"a2","parentUuid":"a1","timestamp":"2025-01-01T10:01:00Z","message":{"content":"deploy script written"}}
+`, 30*24*time.Hour)
+	second := write("second.jsonl", `{"type":"summary","summary":"Deploy work","leafUuid":"a2"}
+{"type":"user","uuid":"b1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"continue the deploy"}}
+`, 10*time.Minute)
+	write("other.jsonl", `{"type":"user","uuid":"c1","timestamp":"2025-01-03T10:00:00Z","message":{"content":"unrelated deploy"}}
+`, 10*time.Minute)
+
+	links := buildSessionLinks([]string{first, second})
+	if chain := links.chain(second); len(chain) != 2 || chain[0] != first || chain[1] != second {
+		t.Fatalf("chain: got %v", chain)
+	}
+
+	// The excluded (current) session is never pulled back in
+	if files, _ := expandContinuations([]string{second}, first); len(files) != 1 {
+		t.Errorf("excluded session added back: %v", files)
+	}
+
+	opts := SearchOpts{Role: "both", MaxDays: 7, MaxResults: 10, FollowContinuations: true}
+	matches, _, err := regexSearch("deploy", dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bySession := make(map[string]string)
+	for _, m := range matches {
+		bySession[m.Message.SessionID] = m.Message.Conversation
+	}
+	if len(bySession) != 3 {
+		t.Fatalf("want matches from first (outside -d), second and other: got %v", bySession)
+	}
+	if bySession["first"] != "first" || bySession["second"] != "first" || bySession["other"] != "" {
+		t.Errorf("conversation IDs: got %v", bySession)
+	}
+
+	opts.FollowContinuations = false
+	matches, _, _ = regexSearch("deploy", dir, opts)
+	for _, m := range matches {
+		if m.Message.SessionID == "first" {
+			t.Error("without --follow-continuations the old session is out of scope")
+		}
+	}
+}
+
+func TestUUIDValues(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`{"parentUuid":"p1","uuid":"u1"}`, []string{"u1"}},
+		{`{"uuid" : "u1","message":{"content":[{"input":{"uuid":"n1"}}]}}`, []string{"u1", "n1"}},
+		{`{"leafUuid":"l1","text":"say \"uuid\": x"}`, nil},
+		{`{"uuid":null}`, nil},
+	}
+	for _, tt := range tests {
+		if got := uuidValues([]byte(tt.line)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
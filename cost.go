@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TokenUsage is the token accounting Claude reports on each response.
+type TokenUsage struct {
+	Input      int64 `json:"input_tokens"`
+	Output     int64 `json:"output_tokens"`
+	CacheWrite int64 `json:"cache_creation_input_tokens"`
+	CacheRead  int64 `json:"cache_read_input_tokens"`
+}
+
+func (u *TokenUsage) add(o TokenUsage) {
+	u.Input += o.Input
+	u.Output += o.Output
+	u.CacheWrite += o.CacheWrite
+	u.CacheRead += o.CacheRead
+}
+
+// Price is USD per million tokens for one model.
+type Price struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+func (p Price) cost(u TokenUsage) float64 {
+	return (float64(u.Input)*p.Input + float64(u.Output)*p.Output +
+		float64(u.CacheWrite)*p.CacheWrite + float64(u.CacheRead)*p.CacheRead) / 1e6
+}
+
+// defaultPrices are list prices keyed by model glob. The longest matching
+// glob wins, so specific versions override their family.
+var defaultPrices = map[string]Price{
+	"claude-opus-*":      {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-opus-4-5*":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.50},
+	"claude-sonnet-*":    {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-sonnet*": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-7-sonnet*": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-haiku-*":     {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.10},
+	"claude-3-5-haiku*":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+func pricesPath() string {
+	return filepath.Join(indexDir(), "prices.json")
+}
+
+// loadPrices returns the default price table overlaid with the entries of
+// a JSON file ({"model-glob": {"input": 3, "output": 15, ...}}). An empty
+// path reads pricesPath() if it exists.
+func loadPrices(path string) (map[string]Price, error) {
+	prices := make(map[string]Price, len(defaultPrices))
+	for k, v := range defaultPrices {
+		prices[k] = v
+	}
+
+	explicit := path != ""
+	if !explicit {
+		path = pricesPath()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && os.IsNotExist(err) {
+			return prices, nil
+		}
+		return nil, err
+	}
+	var custom map[string]Price
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for k, v := range custom {
+		prices[k] = v
+	}
+	return prices, nil
+}
+
+// priceFor finds the price of model, preferring the longest matching glob.
+func priceFor(prices map[string]Price, model string) (Price, bool) {
+	best := ""
+	for glob := range prices {
+		if matchGlob(glob, model) && len(glob) > len(best) {
+			best = glob
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return prices[best], true
+}
+
+// usageRecord is the usage of one API response.
+type usageRecord struct {
+	Day     string
+	Project string
+	Session string
+	Model   string
+	Usage   TokenUsage
+}
+
+// usageLine holds the fields of an assistant line that carry usage.
+type usageLine struct {
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	RequestID string `json:"requestId"`
+	Message   struct {
+		ID    string      `json:"id"`
+		Model string      `json:"model"`
+		Usage *TokenUsage `json:"usage"`
+	} `json:"message"`
+}
+
+var usageLit = []byte(`"usage"`)
+
+// scanUsage reads the usage of every API response in a session file made
+// at or after cutoff and, if until is set, before until. A response
+// streamed over several lines repeats its message ID; the last line's
+// (final) usage is kept.
+func scanUsage(fpath string, cutoff, until time.Time) []usageRecord {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	sessionID := extractSessionID(fpath)
+	project := extractProject(fpath)
+	byID := make(map[string]int)
+	var records []usageRecord
+
+	readLines(f, func(line []byte) {
+		if !bytes.Contains(line, usageLit) || !bytes.Contains(line, assistantTypeLit) {
+			return
+		}
+		var l usageLine
+		if json.Unmarshal(line, &l) != nil || l.Type != "assistant" || l.Message.Usage == nil {
+			return
+		}
+		// Synthetic messages (errors, interrupts) cost nothing
+		if l.Message.Model == "" || l.Message.Model == "<synthetic>" {
+			return
+		}
+		ts, err := time.Parse(time.RFC3339, l.Timestamp)
+		if err != nil || ts.Before(cutoff) || (!until.IsZero() && !ts.Before(until)) {
+			return
+		}
+
+		rec := usageRecord{
+			Day:     ts.Local().Format("2006-01-02"),
+			Project: project,
+			Session: sessionID,
+			Model:   l.Message.Model,
+			Usage:   *l.Message.Usage,
+		}
+		key := l.Message.ID + "/" + l.RequestID
+		if i, ok := byID[key]; ok && l.Message.ID != "" {
+			records[i] = rec
+			return
+		}
+		byID[key] = len(records)
+		records = append(records, rec)
+	})
+	return records
+}
+
+// CostRow is the token and cost total for one group.
+type CostRow struct {
+	Key        string   `json:"key"`
+	Responses  int      `json:"responses"`
+	Input      int64    `json:"input_tokens"`
+	Output     int64    `json:"output_tokens"`
+	CacheWrite int64    `json:"cache_write_tokens"`
+	CacheRead  int64    `json:"cache_read_tokens"`
+	CostUSD    float64  `json:"cost_usd"`
+	Unpriced   []string `json:"unpriced_models,omitempty"`
+}
+
+func (r *CostRow) add(u TokenUsage, cost float64) {
+	r.Responses++
+	r.Input += u.Input
+	r.Output += u.Output
+	r.CacheWrite += u.CacheWrite
+	r.CacheRead += u.CacheRead
+	r.CostUSD += cost
+}
+
+// CostReport is the output of the cost subcommand.
+type CostReport struct {
+	By    string    `json:"by"`
+	Since string    `json:"since,omitempty"`
+	Until string    `json:"until,omitempty"`
+	Rows  []CostRow `json:"rows"`
+	Total CostRow   `json:"total"`
+}
+
+// costGroupings are the valid --by values.
+var costGroupings = []string{"day", "project", "session", "model"}
+
+// buildCostReport totals usage records by the given grouping. Days sort
+// chronologically; other groupings sort by cost, highest first.
+func buildCostReport(records []usageRecord, by string, prices map[string]Price, since time.Time) CostReport {
+	rows := make(map[string]*CostRow)
+	report := CostReport{By: by, Total: CostRow{Key: "total"}}
+	if !since.IsZero() {
+		report.Since = since.Format(time.RFC3339)
+	}
+	unpriced := make(map[string]bool)
+
+	for _, rec := range records {
+		var key string
+		switch by {
+		case "project":
+			key = rec.Project
+		case "session":
+			key = rec.Project + "/" + rec.Session
+		case "model":
+			key = rec.Model
+		default:
+			key = rec.Day
+		}
+		row, ok := rows[key]
+		if !ok {
+			row = &CostRow{Key: key}
+			rows[key] = row
+		}
+
+		price, ok := priceFor(prices, rec.Model)
+		if !ok && !unpriced[rec.Model] {
+			unpriced[rec.Model] = true
+			report.Total.Unpriced = append(report.Total.Unpriced, rec.Model)
+		}
+		cost := price.cost(rec.Usage)
+		row.add(rec.Usage, cost)
+		report.Total.add(rec.Usage, cost)
+	}
+
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if by == "day" || report.Rows[i].CostUSD == report.Rows[j].CostUSD {
+			return report.Rows[i].Key < report.Rows[j].Key
+		}
+		return report.Rows[i].CostUSD > report.Rows[j].CostUSD
+	})
+	sort.Strings(report.Total.Unpriced)
+	return report
+}
+
+// runCost scans session files in scope and totals their token usage.
+func runCost(searchPath string, opts SearchOpts, by string, prices map[string]Price) (CostReport, int, error) {
+	maxAge := opts.MaxAge
+	if maxAge == 0 {
+		maxAge = time.Duration(opts.MaxDays) * 24 * time.Hour
+	}
+	files, err := findSessionFilesWithAge(searchPath, maxAge)
+	if err != nil {
+		return CostReport{}, 0, err
+	}
+
+	opts.FollowContinuations = false
+	cutoff, until := opts.window()
+	var records []usageRecord
+	for _, f := range files {
+		records = append(records, scanUsage(f, cutoff, until)...)
+	}
+	report := buildCostReport(records, by, prices, cutoff)
+	if !opts.Until.IsZero() {
+		report.Until = opts.Until.Format(time.RFC3339)
+	}
+	return report, len(files), nil
+}
+
+func formatCostTerminal(report CostReport, w io.Writer) {
+	keys := make([]string, len(report.Rows))
+	width := len(strings.ToUpper(report.By))
+	for i, row := range report.Rows {
+		keys[i] = row.Key
+		if report.By == "session" {
+			if project, id, ok := strings.Cut(row.Key, "/"); ok {
+				keys[i] = project + "/" + shortID(id)
+			}
+		}
+		width = max(width, len(keys[i]))
+	}
+
+	line := func(key string, r CostRow) {
+		fmt.Fprintf(w, "%-*s  %8s %8s %9s %9s  %10s\n", width, key,
+			formatTokens(r.Input), formatTokens(r.Output),
+			formatTokens(r.CacheWrite), formatTokens(r.CacheRead),
+			fmt.Sprintf("$%.2f", r.CostUSD))
+	}
+
+	fmt.Fprintf(w, "%-*s  %8s %8s %9s %9s  %10s\n", width, strings.ToUpper(report.By),
+		"INPUT", "OUTPUT", "CACHE-W", "CACHE-R", "COST")
+	for i, row := range report.Rows {
+		line(keys[i], row)
+	}
+	line("TOTAL", report.Total)
+}
+
+func formatCostJSON(report CostReport, w io.Writer) {
+	if report.Rows == nil {
+		report.Rows = []CostRow{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+// formatTokens abbreviates a token count: 950, 12.3K, 4.1M.
+func formatTokens(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriceFor(t *testing.T) {
+	prices, err := loadPrices(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Fatal("explicit missing price file should fail")
+	}
+
+	prices = defaultPrices
+	tests := []struct {
+		model string
+		input float64
+		ok    bool
+	}{
+		{"claude-opus-4-1-20250805", 15, true},
+		{"claude-opus-4-5-20251101", 5, true},
+		{"claude-sonnet-4-5-20250929", 3, true},
+		{"claude-3-5-haiku-20241022", 0.80, true},
+		{"gpt-4o", 0, false},
+	}
+	for _, tt := range tests {
+		p, ok := priceFor(prices, tt.model)
+		if ok != tt.ok || p.Input != tt.input {
+			t.Errorf("priceFor(%q) = %v, %v; want input %v, %v", tt.model, p.Input, ok, tt.input, tt.ok)
+		}
+	}
+}
+
+func TestLoadPricesOverlay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	os.WriteFile(path, []byte(`{"claude-sonnet-*": {"input": 1, "output": 2}, "local-*": {"input": 0.5}}`), 0644)
+
+	prices, err := loadPrices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := priceFor(prices, "claude-sonnet-4-5"); p.Input != 1 || p.Output != 2 {
+		t.Errorf("override not applied: %+v", p)
+	}
+	if p, ok := priceFor(prices, "local-llama"); !ok || p.Input != 0.5 {
+		t.Errorf("new entry not added: %+v %v", p, ok)
+	}
+	if _, ok := priceFor(prices, "claude-opus-4"); !ok {
+		t.Error("defaults should survive an overlay")
+	}
+}
+
+func TestScanUsage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+
+	// msg_1 is streamed over two lines; only its final usage counts
+	data := `{"type":"user","timestamp":"2025-01-02T10:00:00.000Z","message":{"content":"hi"}}
+{"type":"assistant","timestamp":"2025-01-02T10:00:01.000Z","requestId":"req_1","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"a"}],"usage":{"input_tokens":10,"output_tokens":1}}}
+{"type":"assistant","timestamp":"2025-01-02T10:00:02.000Z","requestId":"req_1","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{}}],"usage":{"input_tokens":10,"output_tokens":50,"cache_read_input_tokens":1000}}}
+{"type":"assistant","timestamp":"2025-01-02T10:01:00.000Z","requestId":"req_2","message":{"id":"msg_2","model":"claude-opus-4-1","content":[{"type":"text","text":"b"}],"usage":{"input_tokens":100,"output_tokens":200}}}
+{"type":"assistant","timestamp":"2025-01-02T10:02:00.000Z","message":{"id":"msg_3","model":"<synthetic>","content":[{"type":"text","text":"No response requested."}],"usage":{"input_tokens":0,"output_tokens":0}}}
+{"type":"assistant","timestamp":"2024-12-01T10:00:00.000Z","requestId":"req_0","message":{"id":"msg_0","model":"claude-sonnet-4-5","content":[],"usage":{"input_tokens":999,"output_tokens":999}}}
+`
+	fpath := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fpath, []byte(data), 0644)
+
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := scanUsage(fpath, cutoff, time.Time{})
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(records), records)
+	}
+	if r := scanUsage(fpath, cutoff, time.Date(2025, 1, 2, 10, 1, 0, 0, time.UTC)); len(r) != 1 {
+		t.Errorf("until should drop the response at 10:01, got %+v", r)
+	}
+	if u := records[0].Usage; u.Output != 50 || u.CacheRead != 1000 {
+		t.Errorf("streamed response should keep final usage: %+v", u)
+	}
+
+	report := buildCostReport(records, "model", defaultPrices, cutoff)
+	if len(report.Rows) != 2 || report.Rows[0].Key != "claude-opus-4-1" {
+		t.Fatalf("rows should sort by cost: %+v", report.Rows)
+	}
+	// sonnet: 10*3 + 50*15 + 1000*0.30 = 1080; opus: 100*15 + 200*75 = 16500
+	if want := (1080.0 + 16500.0) / 1e6; math.Abs(report.Total.CostUSD-want) > 1e-9 {
+		t.Errorf("total cost = %v, want %v", report.Total.CostUSD, want)
+	}
+	if report.Total.Responses != 2 || report.Total.Input != 110 {
+		t.Errorf("total = %+v", report.Total)
+	}
+}
+
+func TestBuildCostReportUnpriced(t *testing.T) {
+	records := []usageRecord{
+		{Day: "2025-01-02", Model: "mystery-model", Usage: TokenUsage{Input: 100}},
+		{Day: "2025-01-01", Model: "claude-sonnet-4-5", Usage: TokenUsage{Input: 100}},
+	}
+	report := buildCostReport(records, "day", defaultPrices, time.Time{})
+	if report.Rows[0].Key != "2025-01-01" {
+		t.Errorf("days should sort chronologically: %+v", report.Rows)
+	}
+	if len(report.Total.Unpriced) != 1 || report.Total.Unpriced[0] != "mystery-model" {
+		t.Errorf("unpriced = %v", report.Total.Unpriced)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Embedder turns text into a vector for semantic search. The backend is
+// chosen by ~/.claude/search-index/embedder.json or CLAUDE_GREP_EMBED*
+// environment variables; see loadEmbedderConfig.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+	// Check reports why the backend can't embed right now, if it can't.
+	Check() error
+	// ID names the backend and model; vectors are only comparable
+	// between embedders with the same ID.
+	ID() EmbedderID
+	// Threshold is the cosine similarity below which a message is
+	// considered unrelated. It depends on the model's baseline.
+	Threshold() float32
+}
+
+// EmbedderID identifies the model that produced a vector.
+type EmbedderID struct {
+	Backend string // "ollama", "openai" or "builtin"; never "auto"
+	Model   string
+}
+
+func (id EmbedderID) String() string {
+	return id.Backend + "/" + id.Model
+}
+
+const (
+	defaultOllamaURL = "http://localhost:11434"
+	defaultOpenAIURL = "http://localhost:8080" // llama.cpp server
+	builtinDims      = 512
+)
+
+// EmbedderConfig is the embedder.json file. Environment variables
+// override it field by field.
+type EmbedderConfig struct {
+	Backend       string  `json:"backend"`                  // CLAUDE_GREP_EMBEDDER
+	URL           string  `json:"url,omitempty"`            // CLAUDE_GREP_EMBED_URL
+	Model         string  `json:"model,omitempty"`          // CLAUDE_GREP_EMBED_MODEL
+	APIKey        string  `json:"api_key,omitempty"`        // CLAUDE_GREP_EMBED_API_KEY
+	MinSimilarity float32 `json:"min_similarity,omitempty"` // CLAUDE_GREP_EMBED_MIN_SIMILARITY
+}
+
+func embedderConfigPath() string {
+	return filepath.Join(indexDir(), "embedder.json")
+}
+
+// loadEmbedderConfig reads embedder.json, if any, and applies the
+// environment on top. The default is auto: ollama with nomic-embed-text
+// when it is running, else the built-in embedder.
+func loadEmbedderConfig() (EmbedderConfig, error) {
+	var cfg EmbedderConfig
+	path := embedderConfigPath()
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return cfg, err
+	}
+
+	for _, e := range []struct {
+		name string
+		dst  *string
+	}{
+		{"CLAUDE_GREP_EMBEDDER", &cfg.Backend},
+		{"CLAUDE_GREP_EMBED_URL", &cfg.URL},
+		{"CLAUDE_GREP_EMBED_MODEL", &cfg.Model},
+		{"CLAUDE_GREP_EMBED_API_KEY", &cfg.APIKey},
+	} {
+		if v := os.Getenv(e.name); v != "" {
+			*e.dst = v
+		}
+	}
+	if v := os.Getenv("CLAUDE_GREP_EMBED_MIN_SIMILARITY"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("CLAUDE_GREP_EMBED_MIN_SIMILARITY: %w", err)
+		}
+		cfg.MinSimilarity = float32(f)
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "auto"
+	}
+	return cfg, nil
+}
+
+// newEmbedder returns the configured embedder. The auto backend asks
+// ollama whether it is running and stands in the built-in embedder if
+// not, so semantic search works with no model server at all.
+func newEmbedder() (Embedder, error) {
+	cfg, err := loadEmbedderConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Backend != "auto" {
+		return cfg.embedder(cfg.Backend)
+	}
+	ollama, err := cfg.embedder("ollama")
+	if err == nil && ollama.Check() == nil {
+		return ollama, nil
+	}
+	return &ngramEmbedder{dims: builtinDims, threshold: cfg.threshold(ngramThreshold), standIn: true}, nil
+}
+
+// threshold is the configured minimum similarity, or def.
+func (cfg EmbedderConfig) threshold(def float32) float32 {
+	if cfg.MinSimilarity > 0 {
+		return cfg.MinSimilarity
+	}
+	return def
+}
+
+// embedder builds the named backend from cfg.
+func (cfg EmbedderConfig) embedder(backend string) (Embedder, error) {
+	switch backend {
+	case "ollama":
+		e := &ollamaEmbedder{url: defaultOllamaURL, model: embedModel}
+		if cfg.URL != "" {
+			e.url = strings.TrimSuffix(cfg.URL, "/")
+		}
+		if cfg.Model != "" {
+			e.model = cfg.Model
+		}
+		// 0.3 was too low — nomic-embed-text's baseline is high
+		e.threshold = cfg.threshold(0.55)
+		return e, nil
+	case "openai":
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("the openai embedder needs a model: set CLAUDE_GREP_EMBED_MODEL or \"model\" in %s", embedderConfigPath())
+		}
+		e := &openAIEmbedder{url: defaultOpenAIURL, model: cfg.Model, apiKey: cfg.APIKey}
+		if cfg.URL != "" {
+			e.url = strings.TrimSuffix(strings.TrimSuffix(cfg.URL, "/"), "/v1")
+		}
+		if e.apiKey == "" {
+			e.apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		e.threshold = cfg.threshold(0.3)
+		return e, nil
+	case "builtin":
+		return &ngramEmbedder{dims: builtinDims, threshold: cfg.threshold(ngramThreshold)}, nil
+	}
+	return nil, fmt.Errorf("unknown embedder %q (use auto, ollama, openai or builtin)", backend)
+}
+
+// readyEmbedder returns the configured embedder if it can embed now.
+func readyEmbedder() (Embedder, error) {
+	e, err := newEmbedder()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Check(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// searchEmbedder returns the embedder for a query against indexes built
+// with the given models. With the auto backend, an index still built by
+// the built-in embedder stays searchable after ollama comes up, until
+// --index re-embeds it.
+func searchEmbedder(indexed map[EmbedderID]bool) (Embedder, error) {
+	e, err := readyEmbedder()
+	if err != nil || indexed[e.ID()] {
+		return e, err
+	}
+	cfg, _ := loadEmbedderConfig() // readyEmbedder already parsed it
+	if cfg.Backend != "auto" {
+		return e, nil
+	}
+	if builtin, _ := cfg.embedder("builtin"); indexed[builtin.ID()] {
+		return builtin, nil
+	}
+	// Standing in for ollama against an index ollama built: say it's down
+	if ollama, err := cfg.embedder("ollama"); err == nil && indexed[ollama.ID()] {
+		if err := ollama.Check(); err != nil {
+			return nil, err
+		}
+		return ollama, nil
+	}
+	return e, nil
+}
+
+// replaces reports whether --index with e should re-embed vectors that
+// were built with old. The built-in embedder standing in for ollama never
+// throws away a real model's vectors; they wait for ollama to come back.
+func replaces(e Embedder, old EmbedderID) bool {
+	if b, ok := e.(*ngramEmbedder); ok && b.standIn && old.Backend != "builtin" {
+		return false
+	}
+	return e.ID() != old
+}
+
+// embedderReady reports whether semantic search can run.
+func embedderReady() bool {
+	_, err := readyEmbedder()
+	return err == nil
+}
+
+// ollamaEmbedder calls ollama's /api/embed.
+type ollamaEmbedder struct {
+	url       string
+	model     string
+	threshold float32
+}
+
+type embedRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type embedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (e *ollamaEmbedder) ID() EmbedderID     { return EmbedderID{"ollama", e.model} }
+func (e *ollamaEmbedder) Threshold() float32 { return e.threshold }
+
+func (e *ollamaEmbedder) Embed(text string) ([]float32, error) {
+	var result embedResponse
+	if err := postJSON(e.url+"/api/embed", "", embedRequest{Model: e.model, Input: text}, &result); err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+	if len(result.Embeddings) == 0 {
+		return nil, fmt.Errorf("no embeddings returned")
+	}
+	return result.Embeddings[0], nil
+}
+
+// ollamaProbes caches Check by server URL: the auto backend, the
+// fallback and semantic search all ask, and a server that is down costs
+// the full timeout each time.
+var ollamaProbes = map[string]error{}
+
+func (e *ollamaEmbedder) Check() error {
+	if err, ok := ollamaProbes[e.url]; ok {
+		return err
+	}
+	err := fmt.Errorf("ollama not running — start with: ollama serve")
+	client := http.Client{Timeout: 2 * time.Second}
+	if resp, getErr := client.Get(e.url + "/"); getErr == nil {
+		resp.Body.Close()
+		if resp.StatusCode == 200 {
+			err = nil
+		}
+	}
+	ollamaProbes[e.url] = err
+	return err
+}
+
+// openAIEmbedder calls an OpenAI-compatible /v1/embeddings endpoint, as
+// served by llama.cpp, vLLM, LM Studio and LocalAI.
+type openAIEmbedder struct {
+	url       string // without the /v1 suffix
+	model     string
+	apiKey    string
+	threshold float32
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *openAIEmbedder) ID() EmbedderID     { return EmbedderID{"openai", e.model} }
+func (e *openAIEmbedder) Threshold() float32 { return e.threshold }
+
+func (e *openAIEmbedder) Embed(text string) ([]float32, error) {
+	var result openAIEmbedResponse
+	if err := postJSON(e.url+"/v1/embeddings", e.apiKey, embedRequest{Model: e.model, Input: text}, &result); err != nil {
+		return nil, fmt.Errorf("%s: %w", e.url, err)
+	}
+	if len(result.Data) == 0 || len(result.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embeddings returned")
+	}
+	return result.Data[0].Embedding, nil
+}
+
+func (e *openAIEmbedder) Check() error {
+	client := http.Client{Timeout: 2 * time.Second}
+	req, err := http.NewRequest("GET", e.url+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("embedding server not reachable at %s — start it or set CLAUDE_GREP_EMBED_URL", e.url)
+	}
+	defer resp.Body.Close()
+	// A bad key or path answers too, but every embed would then fail
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("embedding server at %s returned %d: %s", e.url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// postJSON posts body as JSON and decodes a 200 response into out.
+func postJSON(url, apiKey string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// ngramEmbedder is the built-in embedder. It needs no model or server
+// and always gives the same vector for the same text, so --index and -s
+// work offline and tests get deterministic vectors.
+//
+// A text's features are its stemmed words, adjacent word pairs, and the
+// character trigrams of each word, so "deploying" still lands near
+// "redeploy" and "auth" near "oauth". The sparse feature vector is
+// reduced to dims by a sparse random projection: each feature adds its
+// weight to ngramSpread pseudo-random dimensions with pseudo-random
+// signs, which keeps cosine similarity roughly intact. It captures shared
+// vocabulary rather than meaning; a real model is better when available.
+type ngramEmbedder struct {
+	dims      int
+	threshold float32
+	standIn   bool // picked by the auto backend because ollama is down
+}
+
+const (
+	ngramSpread     = 4    // dimensions each feature projects onto
+	ngramPairWeight = 0.5  // a word pair relative to a word
+	ngramCharWeight = 0.25 // all of a word's trigrams together, relative to the word
+	ngramThreshold  = 0.2
+)
+
+func (e *ngramEmbedder) ID() EmbedderID {
+	return EmbedderID{"builtin", "ngram-" + strconv.Itoa(e.dims)}
+}
+func (e *ngramEmbedder) Threshold() float32 { return e.threshold }
+func (e *ngramEmbedder) Check() error       { return nil }
+
+func (e *ngramEmbedder) Embed(text string) ([]float32, error) {
+	features := make(map[string]float64)
+	words := tokenize(text)
+	for i, w := range words {
+		features["w:"+w]++
+		if i > 0 {
+			features["p:"+words[i-1]+"_"+w] += ngramPairWeight
+		}
+		padded := []rune("^" + w + "$")
+		n := float64(len(padded) - 2)
+		for j := 0; j+3 <= len(padded); j++ {
+			features["c:"+string(padded[j:j+3])] += ngramCharWeight / n
+		}
+	}
+
+	vec := make([]float32, e.dims)
+	for f, tf := range features {
+		// Dampen repeats so one word said ten times doesn't dominate
+		w := float32(tf)
+		if tf > 1 {
+			w = float32(1 + math.Log(tf))
+		}
+		h := fnv.New64a()
+		h.Write([]byte(f))
+		seed := h.Sum64()
+		for i := uint64(0); i < ngramSpread; i++ {
+			x := mix64(seed + i)
+			if x>>63 == 1 {
+				vec[x%uint64(e.dims)] -= w
+			} else {
+				vec[x%uint64(e.dims)] += w
+			}
+		}
+	}
+	normalize(vec)
+	return vec, nil
+}
+
+// mix64 is the splitmix64 finalizer: a cheap, well-spread 64-bit hash.
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// normalize scales vec to unit length in place; a zero vector is left as is.
+func normalize(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= n
+	}
+}
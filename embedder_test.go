@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewEmbedder(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, name := range []string{"CLAUDE_GREP_EMBEDDER", "CLAUDE_GREP_EMBED_URL", "CLAUDE_GREP_EMBED_MODEL", "CLAUDE_GREP_EMBED_API_KEY", "CLAUDE_GREP_EMBED_MIN_SIMILARITY"} {
+		t.Setenv(name, "")
+	}
+
+	// auto: the built-in embedder stands in while ollama is down
+	t.Setenv("CLAUDE_GREP_EMBED_URL", "http://127.0.0.1:1")
+	e, err := newEmbedder()
+	if b, ok := e.(*ngramEmbedder); err != nil || !ok || !b.standIn || e.Threshold() != ngramThreshold {
+		t.Errorf("default, ollama down: got %v, err %v", e, err)
+	}
+	// and ollama is used once it's up
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	t.Setenv("CLAUDE_GREP_EMBED_URL", srv.URL)
+	if e, err = newEmbedder(); err != nil || e.ID() != (EmbedderID{"ollama", "nomic-embed-text"}) || e.Threshold() != 0.55 {
+		t.Errorf("default, ollama up: got %v, err %v", e, err)
+	}
+	t.Setenv("CLAUDE_GREP_EMBED_URL", "")
+
+	// The config file picks the backend; the environment overrides it
+	os.MkdirAll(indexDir(), 0755)
+	os.WriteFile(embedderConfigPath(), []byte(`{"backend":"openai","url":"http://gpu:8000/v1/","model":"bge-small"}`), 0644)
+	e, err = newEmbedder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := e.(*openAIEmbedder); !ok || o.url != "http://gpu:8000" || o.model != "bge-small" {
+		t.Errorf("config: got %+v", e)
+	}
+	t.Setenv("CLAUDE_GREP_EMBED_MODEL", "e5-large")
+	t.Setenv("CLAUDE_GREP_EMBED_MIN_SIMILARITY", "0.4")
+	if e, _ = newEmbedder(); e.ID().Model != "e5-large" || e.Threshold() != 0.4 {
+		t.Errorf("env: got %v, threshold %v", e.ID(), e.Threshold())
+	}
+
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "builtin")
+	if e, _ = newEmbedder(); e.ID().Backend != "builtin" || e.Check() != nil {
+		t.Errorf("builtin: got %v", e.ID())
+	}
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "word2vec")
+	if _, err = newEmbedder(); err == nil {
+		t.Error("unknown backend should be an error")
+	}
+}
+
+func TestHTTPEmbedders(t *testing.T) {
+	var gotAuth, gotModel string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		gotAuth, gotModel = r.Header.Get("Authorization"), req.Model
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("Ollama is running"))
+		case "/api/embed":
+			w.Write([]byte(`{"embeddings":[[0.1,0.2,0.3]]}`))
+		case "/v1/models":
+			w.Write([]byte(`{"data":[]}`))
+		case "/v1/embeddings":
+			w.Write([]byte(`{"data":[{"index":0,"embedding":[0.4,0.5]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ollama := &ollamaEmbedder{url: srv.URL, model: "nomic-embed-text"}
+	if err := ollama.Check(); err != nil {
+		t.Errorf("ollama check: %v", err)
+	}
+	if vec, err := ollama.Embed("hello"); err != nil || len(vec) != 3 || gotModel != "nomic-embed-text" {
+		t.Errorf("ollama: got %v, err %v, model %q", vec, err, gotModel)
+	}
+
+	openai := &openAIEmbedder{url: srv.URL, model: "bge-small", apiKey: "sk-test"}
+	if err := openai.Check(); err != nil {
+		t.Errorf("openai check: %v", err)
+	}
+	if vec, err := openai.Embed("hello"); err != nil || len(vec) != 2 || gotAuth != "Bearer sk-test" {
+		t.Errorf("openai: got %v, err %v, auth %q", vec, err, gotAuth)
+	}
+
+	// A server that answers but refuses the key isn't ready
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer denied.Close()
+	bad := &openAIEmbedder{url: denied.URL, model: "bge-small", apiKey: "sk-wrong"}
+	if err := bad.Check(); err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid api key") {
+		t.Errorf("openai with a bad key: %v", err)
+	}
+
+	down := &ollamaEmbedder{url: "http://127.0.0.1:1"}
+	if err := down.Check(); err == nil || !strings.Contains(err.Error(), "ollama serve") {
+		t.Errorf("unreachable ollama: %v", err)
+	}
+}
+
+func TestNgramEmbedder(t *testing.T) {
+	e := &ngramEmbedder{dims: builtinDims}
+	tests := []struct {
+		query, related, unrelated string
+	}{
+		{"fix the invoice rounding bug", "invoice rounding is off by a cent", "deploy the staging cluster"},
+		// Character trigrams match across word forms
+		{"deploying to staging failed", "redeploy staging after the failure", "the unit tests for the parser"},
+		{"oauth token refresh", "auth tokens expire too early", "rename the css classes in the sidebar"},
+		{"database migration for users table", "add a column to the users table with a migration", "why is the webpack build slow"},
+	}
+	for _, tt := range tests {
+		q, _ := e.Embed(tt.query)
+		r, _ := e.Embed(tt.related)
+		u, _ := e.Embed(tt.unrelated)
+		if sim := cosineSimilarity(q, r); sim <= ngramThreshold {
+			t.Errorf("%q ~ %q: %v, want above the threshold", tt.query, tt.related, sim)
+		}
+		if sim := cosineSimilarity(q, u); sim > ngramThreshold {
+			t.Errorf("%q ~ %q: %v, want below the threshold", tt.query, tt.unrelated, sim)
+		}
+	}
+
+	a, _ := e.Embed("fix the invoice rounding bug")
+	b, _ := (&ngramEmbedder{dims: builtinDims}).Embed("fix the invoice rounding bug")
+	if len(a) != builtinDims || !slices.Equal(a, b) {
+		t.Error("same text should embed identically")
+	}
+	if z, _ := e.Embed("the of"); cosineSimilarity(a, z) != 0 {
+		t.Error("stop words only should give a zero vector")
+	}
+}
+
+func TestOllamaProbeCached(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "")
+	probes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { probes++ }))
+	defer srv.Close()
+	t.Setenv("CLAUDE_GREP_EMBED_URL", srv.URL)
+
+	newEmbedder()
+	embedderReady()
+	searchEmbedder(map[EmbedderID]bool{{"ollama", "nomic-embed-text"}: true})
+	if probes != 1 {
+		t.Errorf("ollama probed %d times, want 1", probes)
+	}
+}
+
+func TestAutoEmbedderIndexes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "")
+	t.Setenv("CLAUDE_GREP_EMBED_URL", "http://127.0.0.1:1")
+	ollama := EmbedderID{"ollama", "nomic-embed-text"}
+	builtin := (&ngramEmbedder{dims: builtinDims}).ID()
+
+	// With ollama down, the stand-in upgrades old built-in vectors but
+	// keeps ollama's
+	standIn, _ := newEmbedder()
+	if !replaces(standIn, EmbedderID{"builtin", "hash-256"}) || replaces(standIn, ollama) || replaces(standIn, builtin) {
+		t.Error("stand-in replaces the wrong indexes")
+	}
+	if _, err := searchEmbedder(map[EmbedderID]bool{ollama: true}); err == nil || !strings.Contains(err.Error(), "ollama serve") {
+		t.Errorf("ollama index with ollama down: err %v", err)
+	}
+
+	// With ollama up, a built-in index stays searchable until --index
+	// re-embeds it with ollama
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	t.Setenv("CLAUDE_GREP_EMBED_URL", srv.URL)
+	if e, err := searchEmbedder(map[EmbedderID]bool{builtin: true}); err != nil || e.ID() != builtin {
+		t.Errorf("built-in index with ollama up: got %v, err %v", e, err)
+	}
+	if e, _ := newEmbedder(); !replaces(e, builtin) {
+		t.Error("ollama should replace built-in vectors")
+	}
+
+	// An explicit backend is used as is
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "ollama")
+	if e, err := searchEmbedder(map[EmbedderID]bool{builtin: true}); err != nil || e.ID() != ollama {
+		t.Errorf("explicit ollama: got %v, err %v", e, err)
+	}
+}
+
+func TestSemanticSearchModelMismatch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "builtin")
+	dir := filepath.Join(home, ".claude", "projects", "proj")
+	os.MkdirAll(dir, 0755)
+	fp := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"fix the invoice rounding bug"}}
+`), 0644)
+
+	e, _ := newEmbedder()
+	vec, _ := e.Embed("fix the invoice rounding bug")
+	entry := newIndexEntry(Message{Role: "user", Type: "user", Text: "fix the invoice rounding bug", FilePath: fp, UUID: "u1", Timestamp: "2025-01-02T10:00:00"})
+	entry.Vector = vec
+	idx := &Index{Project: "proj", Files: map[string]FileMetadata{fp: {FilePath: fp}}, Entries: []IndexEntry{entry}, Embedder: e.ID(), Dims: len(vec), Format: indexFormat}
+	saveIndex(idx)
+
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+	base := filepath.Join(home, ".claude", "projects")
+	matches, err := semanticSearch("invoice rounding", base, opts)
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("same model: got %d matches, err %v", len(matches), err)
+	}
+
+	// An index in an older format is skipped until --index rebuilds it
+	idx.Format = 0
+	saveIndex(idx)
+	if _, err := semanticSearch("invoice rounding", base, opts); err == nil || !strings.Contains(err.Error(), "old format") {
+		t.Errorf("old format: err %v, want a reindex hint", err)
+	}
+	idx.Format = indexFormat
+
+	// An index from another model is never compared against
+	idx.Embedder = EmbedderID{"ollama", "nomic-embed-text"}
+	saveIndex(idx)
+	if _, err := semanticSearch("invoice rounding", base, opts); err == nil || !strings.Contains(err.Error(), "--index") {
+		t.Errorf("other model: err %v, want a reindex hint", err)
+	}
+}
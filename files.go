@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FileOp is one file tool call (Read, Edit, Write, ...) on a matching path.
+type FileOp struct {
+	Timestamp string `json:"timestamp"`
+	Tool      string `json:"tool"`
+	File      string `json:"file"`
+}
+
+// SessionFileOps is the file activity of one session, oldest first.
+type SessionFileOps struct {
+	Session string   `json:"session"`
+	Project string   `json:"project"`
+	First   string   `json:"first"`
+	Last    string   `json:"last"`
+	Ops     []FileOp `json:"operations"`
+}
+
+// fileTimeline finds every session whose file tool calls touched a path
+// matching glob. Sessions are returned oldest first, capped at
+// opts.MaxResults (the most recent sessions are kept).
+func fileTimeline(glob, searchPath string, opts SearchOpts) ([]SessionFileOps, SearchStats, error) {
+	opts.File = glob
+	opts.Role = "both"
+	opts.Tool = ""
+	opts.Before, opts.After = 0, 0
+	limit := opts.MaxResults
+	opts.MaxResults = int(^uint(0) >> 1)
+
+	matches, stats, err := regexSearch("", searchPath, opts)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	bySession := make(map[string]*SessionFileOps)
+	for _, m := range matches {
+		key := m.Message.Project + "/" + m.Message.SessionID
+		s, ok := bySession[key]
+		if !ok {
+			s = &SessionFileOps{Session: m.Message.SessionID, Project: m.Message.Project}
+			bySession[key] = s
+		}
+		s.Ops = append(s.Ops, FileOp{
+			Timestamp: m.Message.Timestamp,
+			Tool:      m.Message.Tool,
+			File:      m.Message.Target,
+		})
+	}
+
+	var sessions []SessionFileOps
+	for _, s := range bySession {
+		sort.SliceStable(s.Ops, func(i, j int) bool { return s.Ops[i].Timestamp < s.Ops[j].Timestamp })
+		s.First = s.Ops[0].Timestamp
+		s.Last = s.Ops[len(s.Ops)-1].Timestamp
+		sessions = append(sessions, *s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].First < sessions[j].First })
+
+	if limit > 0 && len(sessions) > limit {
+		sessions = sessions[len(sessions)-limit:]
+	}
+	return sessions, stats, nil
+}
+
+// formatFileTimeline prints one block per session listing each operation,
+// or one line per session with counts when listOnly is set.
+func formatFileTimeline(sessions []SessionFileOps, listOnly bool, w io.Writer) {
+	for i, s := range sessions {
+		if listOnly {
+			fmt.Fprintf(w, "%s  %s  %s\n", s.Session, s.Last, summarizeOps(s.Ops))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "--- %s/%s (%s → %s) ---\n", s.Project, shortID(s.Session), s.First, s.Last)
+		for _, op := range s.Ops {
+			fmt.Fprintf(w, "  %s %-9s %s\n", op.Timestamp, op.Tool, op.File)
+		}
+	}
+}
+
+// summarizeOps renders operation counts like "Read×2 Edit×3", in first-seen order.
+func summarizeOps(ops []FileOp) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, op := range ops {
+		if counts[op.Tool] == 0 {
+			order = append(order, op.Tool)
+		}
+		counts[op.Tool]++
+	}
+	parts := make([]string, len(order))
+	for i, tool := range order {
+		parts[i] = fmt.Sprintf("%s×%d", tool, counts[tool])
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFileTimelineJSON(sessions []SessionFileOps, w io.Writer) {
+	if sessions == nil {
+		sessions = []SessionFileOps{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(sessions)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTimeline(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+
+	a := `{"type":"assistant","timestamp":"2025-01-02T10:00:00.000Z","message":{"content":[{"type":"tool_use","id":"t1","name":"Read","input":{"file_path":"/src/billing/invoice.go"}}]}}
+{"type":"assistant","timestamp":"2025-01-02T10:05:00.000Z","message":{"content":[{"type":"tool_use","id":"t2","name":"Edit","input":{"file_path":"/src/billing/invoice.go","old_string":"x","new_string":"y"}}]}}
+{"type":"assistant","timestamp":"2025-01-02T10:06:00.000Z","message":{"content":[{"type":"tool_use","id":"t3","name":"Edit","input":{"file_path":"/src/billing/tax.go"}}]}}
+`
+	b := `{"type":"user","timestamp":"2025-01-01T09:00:00.000Z","message":{"content":"look at invoice.go please"}}
+{"type":"assistant","timestamp":"2025-01-01T09:01:00.000Z","message":{"content":[{"type":"tool_use","id":"t1","name":"Write","input":{"file_path":"/src/billing/invoice.go","content":"package billing"}}]}}
+`
+	c := `{"type":"user","timestamp":"2025-01-03T09:00:00.000Z","message":{"content":"invoice.go is mentioned but never touched"}}
+`
+	os.WriteFile(filepath.Join(dir, "aaaa.jsonl"), []byte(a), 0644)
+	os.WriteFile(filepath.Join(dir, "bbbb.jsonl"), []byte(b), 0644)
+	os.WriteFile(filepath.Join(dir, "cccc.jsonl"), []byte(c), 0644)
+
+	sessions, _, err := fileTimeline("billing/invoice.go", dir, SearchOpts{MaxDays: 3650, MaxResults: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2: %+v", len(sessions), sessions)
+	}
+	if sessions[0].Session != "bbbb" || sessions[1].Session != "aaaa" {
+		t.Errorf("sessions should be oldest first: %s, %s", sessions[0].Session, sessions[1].Session)
+	}
+	if got := summarizeOps(sessions[1].Ops); got != "Read×1 Edit×1" {
+		t.Errorf("ops for aaaa: got %q", got)
+	}
+	if sessions[1].First != "2025-01-02T10:00:00" || sessions[1].Last != "2025-01-02T10:05:00" {
+		t.Errorf("span: got %s → %s", sessions[1].First, sessions[1].Last)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -26,10 +27,13 @@ func formatTerminal(matches []Match, opts SearchOpts) {
 		}
 	}
 
-	// Group matches by session
+	// Group matches by session (or by resumed chain with --follow-continuations)
 	type sessionGroup struct {
 		project   string
 		sessionID string
+		title     string
+		branch    string
+		sessions  []string // sessions of a resumed chain, in first-match order
 		matches   []Match
 	}
 
@@ -37,15 +41,29 @@ func formatTerminal(matches []Match, opts SearchOpts) {
 	var order []string
 
 	for _, m := range matches {
-		key := m.Message.Project + "/" + m.Message.SessionID
+		id := m.Message.SessionID
+		if m.Message.Conversation != "" {
+			id = m.Message.Conversation
+		}
+		key := m.Message.Project + "/" + id
 		if _, ok := groups[key]; !ok {
 			groups[key] = &sessionGroup{
 				project:   m.Message.Project,
-				sessionID: m.Message.SessionID,
+				sessionID: id,
 			}
 			order = append(order, key)
 		}
-		groups[key].matches = append(groups[key].matches, m)
+		g := groups[key]
+		if g.title == "" {
+			g.title = m.Message.Title
+		}
+		if g.branch == "" {
+			g.branch = m.Message.GitBranch
+		}
+		if !slices.Contains(g.sessions, m.Message.SessionID) {
+			g.sessions = append(g.sessions, m.Message.SessionID)
+		}
+		g.matches = append(g.matches, m)
 	}
 
 	if opts.ListOnly {
@@ -67,9 +85,30 @@ func formatTerminal(matches []Match, opts SearchOpts) {
 			fmt.Println()
 		}
 		g := groups[key]
-		fmt.Printf("--- %s/%s ---\n", g.project, g.sessionID)
+		header := g.project + "/" + shortID(g.sessionID)
+		var resumed []string
+		for _, id := range g.sessions {
+			if id != g.sessionID {
+				resumed = append(resumed, shortID(id))
+			}
+		}
+		if len(resumed) > 0 {
+			header += " (resumed in " + strings.Join(resumed, ", ") + ")"
+		}
+		if g.branch != "" {
+			header += " [" + g.branch + "]"
+		}
+		if g.title != "" {
+			header += ": " + g.title
+		}
+		fmt.Printf("--- %s ---\n", header)
 
-		printed := make(map[int]bool)
+		// Messages are keyed by file as well: a resumed chain spans several
+		type msgKey struct {
+			file string
+			idx  int
+		}
+		printed := make(map[msgKey]bool)
 		for mi, m := range g.matches {
 			// Content dedup: compress first, check if we've seen this text
 			compressed := compressForDisplay(m.Message, true)
@@ -80,28 +119,36 @@ func formatTerminal(matches []Match, opts SearchOpts) {
 
 			// Context before
 			for _, ctx := range m.ContextBefore {
-				if !printed[ctx.MsgIndex] {
-					printMessage(ctx, false, m.Similarity)
-					printed[ctx.MsgIndex] = true
+				if k := (msgKey{ctx.FilePath, ctx.MsgIndex}); !printed[k] {
+					printMessage(ctx, false, 0)
+					printed[k] = true
 				}
 			}
 
 			// The match itself
-			if !printed[m.Message.MsgIndex] {
-				printMessageText(m.Message, compressed, true, m.Similarity)
-				printed[m.Message.MsgIndex] = true
+			if k := (msgKey{m.Message.FilePath, m.Message.MsgIndex}); !printed[k] {
+				printMessageText(m.Message, compressed, true, m.score(), m.Term)
+				printed[k] = true
 			}
 
 			// Context after
 			for _, ctx := range m.ContextAfter {
-				if !printed[ctx.MsgIndex] {
-					printMessage(ctx, false, m.Similarity)
-					printed[ctx.MsgIndex] = true
+				if k := (msgKey{ctx.FilePath, ctx.MsgIndex}); !printed[k] {
+					printMessage(ctx, false, 0)
+					printed[k] = true
+				}
+			}
+
+			// The end of a --near span
+			if p := m.Partner; p != nil {
+				if k := (msgKey{p.FilePath, p.MsgIndex}); !printed[k] {
+					printMessage(*p, true, 0)
+					printed[k] = true
 				}
 			}
 
 			// Separator between match groups
-			if (opts.Before > 0 || opts.After > 0) && mi < len(g.matches)-1 {
+			if (opts.Before > 0 || opts.After > 0 || m.Partner != nil) && mi < len(g.matches)-1 {
 				fmt.Println("  --")
 			}
 		}
@@ -131,16 +178,38 @@ func compressForDisplay(msg Message, isMatch bool) string {
 	return strings.ReplaceAll(text, "\n", " ")
 }
 
-func printMessage(msg Message, isMatch bool, similarity float32) {
+func printMessage(msg Message, isMatch bool, score float64) {
 	text := compressForDisplay(msg, isMatch)
-	printMessageText(msg, text, isMatch, similarity)
+	printMessageText(msg, text, isMatch, score, "")
+}
+
+// score is the ranking score shown with a match: the fused score for
+// hybrid search, BM25 for keyword search, cosine similarity for semantic
+// search, 0 for regex.
+func (m Match) score() float64 {
+	if m.Fused > 0 {
+		return m.Fused
+	}
+	if m.Score > 0 {
+		return m.Score
+	}
+	return float64(m.Similarity)
 }
 
-func printMessageText(msg Message, text string, isMatch bool, similarity float32) {
+func printMessageText(msg Message, text string, isMatch bool, score float64, term string) {
 	tag := "YOU"
-	if msg.Role == "assistant" {
+	if msg.Kind == "tool_use" {
+		tag = msg.Tool
+	} else if msg.Kind == "tool_result" {
+		tag = "OUT"
+	} else if msg.Kind == "thinking" {
+		tag = "THINK"
+	} else if msg.Role == "assistant" {
 		tag = "AI "
 	}
+	if msg.Sidechain {
+		tag = "SUB " + strings.TrimSpace(tag)
+	}
 
 	marker := " "
 	if isMatch {
@@ -148,8 +217,11 @@ func printMessageText(msg Message, text string, isMatch bool, similarity float32
 	}
 
 	simStr := ""
-	if isMatch && similarity > 0 {
-		simStr = fmt.Sprintf(" [%.2f]", similarity)
+	if isMatch && score > 0 {
+		simStr = fmt.Sprintf(" [%.2f]", score)
+	}
+	if isMatch && term != "" {
+		simStr += " {" + term + "}"
 	}
 
 	fmt.Printf("  %s %s [%s]%s %s\n", marker, msg.Timestamp, tag, simStr, text)
@@ -157,46 +229,93 @@ func printMessageText(msg Message, text string, isMatch bool, similarity float32
 
 // JSONMatch is the JSON output structure.
 type JSONMatch struct {
-	Session       string     `json:"session"`
-	Project       string     `json:"project"`
-	Timestamp     string     `json:"timestamp"`
-	Role          string     `json:"role"`
-	Text          string     `json:"text"`
-	Similarity    float32    `json:"similarity,omitempty"`
-	ContextBefore []JSONCtx  `json:"context_before,omitempty"`
-	ContextAfter  []JSONCtx  `json:"context_after,omitempty"`
+	Session       string    `json:"session"`
+	UUID          string    `json:"uuid,omitempty"`
+	Conversation  string    `json:"conversation,omitempty"`
+	Title         string    `json:"title,omitempty"`
+	Project       string    `json:"project"`
+	Cwd           string    `json:"cwd,omitempty"`
+	Branch        string    `json:"branch,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Model         string    `json:"model,omitempty"`
+	Timestamp     string    `json:"timestamp"`
+	Role          string    `json:"role"`
+	Kind          string    `json:"kind"`
+	Tool          string    `json:"tool,omitempty"`
+	File          string    `json:"file,omitempty"`
+	Sidechain     bool      `json:"sidechain,omitempty"`
+	Text          string    `json:"text"`
+	Similarity    float32   `json:"similarity,omitempty"`
+	Score         float64   `json:"score,omitempty"` // BM25, keyword and hybrid search
+	Fused         float64   `json:"fused,omitempty"` // --hybrid ranking score
+	Term          string    `json:"term,omitempty"`
+	ContextBefore []JSONCtx `json:"context_before,omitempty"`
+	ContextAfter  []JSONCtx `json:"context_after,omitempty"`
+	Near          *JSONCtx  `json:"near,omitempty"` // --near: the message matching the second pattern
 }
 
 type JSONCtx struct {
 	Timestamp string `json:"timestamp"`
 	Role      string `json:"role"`
+	Kind      string `json:"kind"`
+	Tool      string `json:"tool,omitempty"`
+	Sidechain bool   `json:"sidechain,omitempty"`
 	Text      string `json:"text"`
 }
 
+// messageKind returns msg.Kind, defaulting to "text" for prose.
+func messageKind(msg Message) string {
+	if msg.Kind == "" {
+		return "text"
+	}
+	return msg.Kind
+}
+
+func jsonCtx(msg Message) JSONCtx {
+	return JSONCtx{
+		Timestamp: msg.Timestamp,
+		Role:      msg.Role,
+		Kind:      messageKind(msg),
+		Tool:      msg.Tool,
+		Sidechain: msg.Sidechain,
+		Text:      msg.Text,
+	}
+}
+
 func formatJSON(matches []Match, w io.Writer) {
 	var out []JSONMatch
 	for _, m := range matches {
 		jm := JSONMatch{
-			Session:    m.Message.SessionID,
-			Project:    m.Message.Project,
-			Timestamp:  m.Message.Timestamp,
-			Role:       m.Message.Role,
-			Text:       m.Message.Text,
-			Similarity: m.Similarity,
+			Session:      m.Message.SessionID,
+			UUID:         m.Message.UUID,
+			Conversation: m.Message.Conversation,
+			Title:        m.Message.Title,
+			Project:      m.Message.Project,
+			Cwd:          m.Message.Cwd,
+			Branch:       m.Message.GitBranch,
+			Version:      m.Message.Version,
+			Model:        m.Message.Model,
+			Timestamp:    m.Message.Timestamp,
+			Role:         m.Message.Role,
+			Kind:         messageKind(m.Message),
+			Tool:         m.Message.Tool,
+			File:         m.Message.Target,
+			Sidechain:    m.Message.Sidechain,
+			Term:         m.Term,
+			Text:         m.Message.Text,
+			Similarity:   m.Similarity,
+			Score:        m.Score,
+			Fused:        m.Fused,
 		}
 		for _, ctx := range m.ContextBefore {
-			jm.ContextBefore = append(jm.ContextBefore, JSONCtx{
-				Timestamp: ctx.Timestamp,
-				Role:      ctx.Role,
-				Text:      ctx.Text,
-			})
+			jm.ContextBefore = append(jm.ContextBefore, jsonCtx(ctx))
 		}
 		for _, ctx := range m.ContextAfter {
-			jm.ContextAfter = append(jm.ContextAfter, JSONCtx{
-				Timestamp: ctx.Timestamp,
-				Role:      ctx.Role,
-				Text:      ctx.Text,
-			})
+			jm.ContextAfter = append(jm.ContextAfter, jsonCtx(ctx))
+		}
+		if m.Partner != nil {
+			near := jsonCtx(*m.Partner)
+			jm.Near = &near
 		}
 		out = append(out, jm)
 	}
@@ -205,3 +324,25 @@ func formatJSON(matches []Match, w io.Writer) {
 	enc.SetIndent("", "  ")
 	enc.Encode(out)
 }
+
+// JSONSession is one session of an -L listing.
+type JSONSession struct {
+	Session  string `json:"session"`
+	Project  string `json:"project"`
+	Modified string `json:"modified"`
+}
+
+// formatSessionsJSON prints the sessions found by invertSearch.
+func formatSessionsJSON(sessions []Match, w io.Writer) {
+	out := []JSONSession{}
+	for _, m := range sessions {
+		out = append(out, JSONSession{
+			Session:  m.Message.SessionID,
+			Project:  m.Message.Project,
+			Modified: m.Message.Timestamp,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
@@ -46,3 +46,20 @@ func TestFormatTerminalNoANSI(t *testing.T) {
 		t.Errorf("output missing role tag: %q", output)
 	}
 }
+
+func TestFormatJSONToolUse(t *testing.T) {
+	matches := []Match{
+		{Message: Message{SessionID: "abc", Role: "assistant", Kind: "tool_use", Tool: "Bash", Text: "make test"}},
+		{Message: Message{SessionID: "abc", Role: "assistant", Text: "done"}},
+	}
+	var buf bytes.Buffer
+	formatJSON(matches, &buf)
+	out := buf.String()
+
+	if !strings.Contains(out, `"kind": "tool_use"`) || !strings.Contains(out, `"tool": "Bash"`) {
+		t.Errorf("tool call missing kind/tool: %s", out)
+	}
+	if !strings.Contains(out, `"kind": "text"`) {
+		t.Errorf("prose should default to kind text: %s", out)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// rrfK damps reciprocal rank fusion: a hit at rank r adds 1/(rrfK+r), so
+// the top few ranks of either list don't drown out the other. 60 is the
+// value from the original RRF paper.
+const rrfK = 60
+
+// hybridSearch runs keyword (BM25) and semantic search for the same query
+// and merges the two rankings by weighted reciprocal rank fusion, so an
+// exact identifier hit and a message that only means the same thing can
+// rank side by side. weight is the semantic ranking's share, 0 to 1.
+// Each match keeps both component scores, and Fused holds the fusion
+// scaled so that ranking first in both lists scores 1.
+func hybridSearch(query, searchPath string, opts SearchOpts, weight float64) ([]Match, SearchStats, error) {
+	// Rank deeper than asked: a message far down one list can still
+	// make the top of the fused one
+	deep := opts
+	deep.MaxResults = max(3*opts.MaxResults, 50)
+
+	keyword, stats, err := keywordSearch(query, searchPath, deep)
+	if err != nil {
+		return nil, stats, err
+	}
+	// Without a usable vector index (none built, or built by a model
+	// that is down) the keyword ranking stands alone
+	var semantic []Match
+	if weight > 0 {
+		if semantic, err = semanticSearch(query, searchPath, deep); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s — ranking by keywords only\n", err)
+		}
+	}
+
+	results := fuseRankings(keyword, semantic, weight)
+	if len(results) > opts.MaxResults {
+		results = results[:opts.MaxResults]
+	}
+	return results, stats, nil
+}
+
+// fuseRankings merges a keyword and a semantic ranking, best first. A
+// message in both lists keeps the keyword match (full text) with the
+// semantic similarity added.
+func fuseRankings(keyword, semantic []Match, weight float64) []Match {
+	type fused struct {
+		match Match
+		score float64
+	}
+	byKey := make(map[hybridKey]*fused)
+	var order []hybridKey
+	add := func(matches []Match, w float64, merge func(dst *Match, src Match)) {
+		for rank, m := range matches {
+			k := matchKey(m.Message)
+			f, ok := byKey[k]
+			if !ok {
+				f = &fused{match: m}
+				byKey[k] = f
+				order = append(order, k)
+			} else if merge != nil {
+				merge(&f.match, m)
+			}
+			f.score += w / float64(rrfK+rank+1)
+		}
+	}
+	add(keyword, 1-weight, nil)
+	add(semantic, weight, func(dst *Match, src Match) { dst.Similarity = src.Similarity })
+
+	results := make([]Match, 0, len(order))
+	for _, k := range order {
+		f := byKey[k]
+		f.match.Fused = f.score * (rrfK + 1)
+		results = append(results, f.match)
+	}
+	// Best first; newer messages win ties
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Fused != results[j].Fused {
+			return results[i].Fused > results[j].Fused
+		}
+		return results[i].Message.Timestamp > results[j].Message.Timestamp
+	})
+	return results
+}
+
+// hybridKey identifies a message across the keyword and vector indexes.
+// Without a uuid a message is known by its timestamp and role, as when
+// parsing, not by its position: a stale vector index may number it
+// differently from a fresh parse.
+type hybridKey struct {
+	file      string
+	uuid      string
+	block     int
+	timestamp string
+	role      string
+}
+
+func matchKey(msg Message) hybridKey {
+	if msg.UUID != "" {
+		return hybridKey{file: msg.FilePath, uuid: msg.UUID, block: msg.Block}
+	}
+	return hybridKey{file: msg.FilePath, block: msg.Block, timestamp: msg.Timestamp, role: msg.Role}
+}
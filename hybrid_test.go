@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFuseRankings(t *testing.T) {
+	msg := func(uuid string) Message {
+		return Message{FilePath: "/p/proj/aaaa.jsonl", UUID: uuid, Timestamp: "2025-01-02T10:00:00"}
+	}
+	keyword := []Match{
+		{Message: msg("exact"), Score: 9.1},
+		{Message: msg("both"), Score: 4.2},
+	}
+	semantic := []Match{
+		{Message: msg("both"), Similarity: 0.81},
+		{Message: msg("meaning"), Similarity: 0.74},
+	}
+
+	tests := []struct {
+		weight float64
+		want   []string
+	}{
+		// Second in one list and first in the other beats first in one
+		{0.5, []string{"both", "exact", "meaning"}},
+		// Keyword ranking only: the semantic-only hit still ranks, last
+		{0, []string{"exact", "both", "meaning"}},
+		{1, []string{"both", "meaning", "exact"}},
+	}
+	for _, tt := range tests {
+		got := fuseRankings(keyword, semantic, tt.weight)
+		if len(got) != len(tt.want) {
+			t.Fatalf("weight %v: got %d results, want %d", tt.weight, len(got), len(tt.want))
+		}
+		for i, m := range got {
+			if m.Message.UUID != tt.want[i] {
+				t.Errorf("weight %v [%d]: got %s, want %s", tt.weight, i, m.Message.UUID, tt.want[i])
+			}
+		}
+	}
+
+	// Both component scores survive the merge
+	got := fuseRankings(keyword, semantic, 0.5)
+	if got[0].Score != 4.2 || got[0].Similarity != 0.81 {
+		t.Errorf("merged match lost a component: %+v", got[0])
+	}
+	// First in both lists fuses to 1
+	got = fuseRankings(keyword[1:], semantic[:1], 0.5)
+	if math.Abs(got[0].Fused-1) > 1e-9 {
+		t.Errorf("top of both lists fused to %v, want 1", got[0].Fused)
+	}
+}
+
+func TestMatchKey(t *testing.T) {
+	a := Message{FilePath: "/p/a.jsonl", UUID: "u1", Block: 1, MsgIndex: 3}
+	b := Message{FilePath: "/p/a.jsonl", UUID: "u1", Block: 1, MsgIndex: 7} // renumbered
+	if matchKey(a) != matchKey(b) {
+		t.Error("same uuid and block should be the same message")
+	}
+	c := Message{FilePath: "/p/a.jsonl", MsgIndex: 3}
+	d := Message{FilePath: "/p/b.jsonl", MsgIndex: 3}
+	if matchKey(c) == matchKey(d) {
+		t.Error("messages in different files collided")
+	}
+	// Without a uuid, a stale index's position doesn't split a message
+	e := Message{FilePath: "/p/a.jsonl", Role: "user", Timestamp: "2025-01-02T10:00:00", MsgIndex: 3}
+	f := e
+	f.MsgIndex = 5
+	if matchKey(e) != matchKey(f) {
+		t.Error("same message at a stale position should be the same message")
+	}
+	f.Role = "assistant"
+	if matchKey(e) == matchKey(f) {
+		t.Error("messages of different roles collided")
+	}
+}
+
+func TestHybridSearchWithoutSemantic(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "")
+	t.Setenv("CLAUDE_GREP_EMBED_URL", "http://127.0.0.1:1") // ollama down
+	dir := filepath.Join(home, ".claude", "projects", "proj")
+	os.MkdirAll(dir, 0755)
+	fp := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"fix the invoice rounding bug"}}
+`), 0644)
+	base := filepath.Join(home, ".claude", "projects")
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+
+	// No vector index at all, then one from ollama while it's down
+	check := func(label string) {
+		t.Helper()
+		matches, _, err := hybridSearch("invoice rounding", base, opts, 0.5)
+		if err != nil || len(matches) != 1 || matches[0].Similarity != 0 {
+			t.Errorf("%s: got %+v, err %v", label, matches, err)
+		}
+	}
+	check("no index")
+	entry := newIndexEntry(Message{Role: "user", Type: "user", Text: "fix the invoice rounding bug", FilePath: fp, UUID: "u1", Timestamp: "2025-01-02T10:00:00"})
+	entry.Vector = []float32{1, 0}
+	saveIndex(&Index{Project: "proj", Files: map[string]FileMetadata{fp: {FilePath: fp}}, Entries: []IndexEntry{entry},
+		Embedder: EmbedderID{"ollama", "nomic-embed-text"}, Dims: 2, Format: indexFormat})
+	check("ollama down")
+}
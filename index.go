@@ -1,20 +1,16 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
 
 const (
-	ollamaURL     = "http://localhost:11434/api/embed"
-	embedModel    = "nomic-embed-text"
+	embedModel    = "nomic-embed-text" // ollama's default model
 	maxEmbedChars = 2048
 	previewLen    = 200
 )
@@ -56,107 +52,154 @@ func runIndex(reindexAll bool) {
 	}
 	defer releaseLock()
 
-	// Check ollama is running
-	if !ollamaReachable() {
-		fmt.Fprintln(os.Stderr, "error: ollama not running — start with: ollama serve")
-		os.Exit(2)
-	}
-
 	home, _ := os.UserHomeDir()
 	projectsDir := filepath.Join(home, ".claude", "projects")
 
 	entries, err := os.ReadDir(projectsDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: cannot read %s: %v\n", projectsDir, err)
+		releaseLock()
 		os.Exit(2)
 	}
 
-	totalNew := 0
-	totalSkipped := 0
-
+	// Find JSONL files
+	var projects []string
+	projectFiles := make(map[string][]string)
 	for _, e := range entries {
 		if !e.IsDir() {
 			continue
 		}
 		project := e.Name()
-		projectPath := filepath.Join(projectsDir, project)
-
-		idx := loadIndex(project)
-		if reindexAll {
-			idx = &Index{Files: make(map[string]FileMetadata), Project: project}
-		}
-
-		// Find JSONL files
-		var files []string
-		filepath.Walk(projectPath, func(path string, info os.FileInfo, err error) error {
+		projects = append(projects, project)
+		filepath.Walk(filepath.Join(projectsDir, project), func(path string, info os.FileInfo, err error) error {
 			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jsonl") {
 				return nil
 			}
-			files = append(files, path)
+			projectFiles[project] = append(projectFiles[project], path)
 			return nil
 		})
+	}
+
+	// The trigram and keyword indexes need no embeddings, so they are
+	// built even when ollama is down
+	triNew, triSkipped, kwNew, kwSkipped := 0, 0, 0, 0
+	for _, project := range projects {
+		n, s, err := updateTrigramIndex(project, projectFiles[project], reindexAll)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error saving trigram index for %s: %v\n", project, err)
+		}
+		triNew += n
+		triSkipped += s
+
+		n, s, err = updateKeywordIndex(project, projectFiles[project], reindexAll)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error saving keyword index for %s: %v\n", project, err)
+		}
+		kwNew += n
+		kwSkipped += s
+	}
+	fmt.Fprintf(os.Stderr, "trigrams: %d files indexed, %d skipped (unchanged)\n", triNew, triSkipped)
+	fmt.Fprintf(os.Stderr, "keywords: %d files indexed, %d skipped (unchanged)\n", kwNew, kwSkipped)
+
+	// Check the embedding backend is up
+	embedder, err := readyEmbedder()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		releaseLock() // os.Exit skips the deferred release
+		os.Exit(2)
+	}
+	model := embedder.ID()
+	if b, ok := embedder.(*ngramEmbedder); ok && b.standIn {
+		fmt.Fprintf(os.Stderr, "ollama not running — embedding with the built-in model; --index upgrades once ollama is up\n")
+	}
+
+	totalNew := 0
+	totalSkipped := 0
 
-		for _, fpath := range files {
+	for _, project := range projects {
+		idx := loadIndex(project)
+		// Vectors from another model can't be compared with new ones
+		if old := idx.embeddedWith(); old != model && len(idx.Entries) > 0 {
+			if !replaces(embedder, old) {
+				fmt.Fprintf(os.Stderr, "keeping %s: indexed with %s, which isn't running\n", project, old)
+				continue
+			}
+			if !reindexAll {
+				fmt.Fprintf(os.Stderr, "re-embedding %s: indexed with %s, now %s\n", project, old, model)
+				idx = &Index{Files: make(map[string]FileMetadata), Project: project}
+			}
+		}
+		if idx.Format < indexFormat && len(idx.Entries) > 0 && !reindexAll {
+			fmt.Fprintf(os.Stderr, "rebuilding %s: index format %d, now %d\n", project, idx.Format, indexFormat)
+			idx = &Index{Files: make(map[string]FileMetadata), Project: project}
+		}
+		if reindexAll {
+			idx = &Index{Files: make(map[string]FileMetadata), Project: project}
+		}
+		idx.Embedder = model
+		idx.Format = indexFormat
+
+		for _, fpath := range projectFiles[project] {
 			info, err := os.Stat(fpath)
 			if err != nil {
 				continue
 			}
 
 			// Check if already indexed (and not modified)
+			var known map[entryKey][]float32
 			if meta, ok := idx.Files[fpath]; ok {
-				if !info.ModTime().After(meta.LastModified) {
+				// Entries without a uuid are found by position, which goes
+				// stale: re-embed them unless the file has no uuids to give
+				if !info.ModTime().After(meta.LastModified) && (meta.NoUUIDs || !entriesLackUUID(idx.Entries, fpath)) {
 					totalSkipped++
 					continue
 				}
-				// File modified — remove old entries for this file
+				// File modified — remove old entries for this file, keeping
+				// their vectors so only new messages are embedded
+				known = entryVectors(idx.Entries, fpath)
 				idx.Entries = removeEntriesForFile(idx.Entries, fpath)
 			}
 
 			// Parse and index
-			data, err := os.ReadFile(fpath)
-			if err != nil {
-				continue
-			}
-
-			messages := parseJSONL(fpath, data)
-			if len(messages) == 0 {
+			messages, err := parseJSONLFile(fpath)
+			if err != nil || len(messages) == 0 {
 				continue
 			}
 
 			sessionID := extractSessionID(fpath)
-			fmt.Fprintf(os.Stderr, "indexing: %s/%s (%d messages)\n", project, sessionID, len(messages))
+			fmt.Fprintf(os.Stderr, "indexing: %s/%s (%d messages)\n", project, shortID(sessionID), len(messages))
 
 			for _, msg := range messages {
-				text := msg.Text
-				if len(text) > maxEmbedChars {
-					text = text[:maxEmbedChars]
-				}
-
-				vec, err := embed(text)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "  embed error: %v\n", err)
+				// Tool output (file dumps, logs) is left to regex search —
+				// embedding it would multiply indexing time for little gain
+				if msg.Kind == "tool_result" {
 					continue
 				}
-
-				preview := msg.Text
-				if len(preview) > previewLen {
-					preview = preview[:previewLen]
+				vec, ok := known[entryKey{msg.UUID, msg.Block}]
+				if !ok || msg.UUID == "" {
+					text := msg.Text
+					if len(text) > maxEmbedChars {
+						text = text[:maxEmbedChars]
+					}
+
+					vec, err = embedder.Embed(text)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "  embed error: %v\n", err)
+						continue
+					}
+					idx.Dims = len(vec)
 				}
 
-				idx.Entries = append(idx.Entries, IndexEntry{
-					SessionID: msg.SessionID,
-					MsgIndex:  msg.MsgIndex,
-					Role:      msg.Role,
-					Timestamp: msg.Timestamp,
-					Preview:   preview,
-					FilePath:  fpath,
-					Vector:    vec,
-				})
+				entry := newIndexEntry(msg)
+				entry.Vector = vec
+				idx.Entries = append(idx.Entries, entry)
 			}
 
 			idx.Files[fpath] = FileMetadata{
 				FilePath:     fpath,
 				LastModified: info.ModTime(),
+				Title:        messages[0].Title,
+				NoUUIDs:      slices.ContainsFunc(messages, func(m Message) bool { return m.UUID == "" }),
 			}
 			totalNew++
 		}
@@ -182,74 +225,63 @@ func printIndexStatus(allProjects bool) {
 	}
 
 	stats := getIndexStats()
-	if stats.Projects == 0 {
+	if stats.Projects == 0 && stats.TrigramFiles == 0 && stats.KeywordFiles == 0 {
 		fmt.Println("no index — run: claude-grep --index")
 		return
 	}
 	fmt.Printf("projects: %d\n", stats.Projects)
 	fmt.Printf("files:    %d\n", stats.Files)
 	fmt.Printf("vectors:  %d\n", stats.Vectors)
-	fmt.Printf("size:     %s\n", formatSize(stats.SizeBytes))
-}
-
-func removeEntriesForFile(entries []IndexEntry, fpath string) []IndexEntry {
-	var kept []IndexEntry
-	for _, e := range entries {
-		if e.FilePath != fpath {
-			kept = append(kept, e)
+	if len(stats.Embedders) > 0 {
+		fmt.Printf("model:    %s\n", strings.Join(stats.Embedders, ", "))
+	}
+	if e, err := newEmbedder(); err == nil && !slices.Contains(stats.Embedders, e.ID().String()) {
+		// The built-in stand-in for ollama leaves ollama's vectors alone
+		stale := len(stats.Embedders) == 0
+		for _, id := range stats.Embedders {
+			backend, model, _ := strings.Cut(id, "/")
+			stale = stale || replaces(e, EmbedderID{backend, model})
+		}
+		if stale {
+			fmt.Printf("          now configured: %s — run: claude-grep --index\n", e.ID())
 		}
 	}
-	return kept
-}
-
-type embedRequest struct {
-	Model string `json:"model"`
-	Input string `json:"input"`
+	if stats.Outdated > 0 {
+		fmt.Printf("          %d project(s) in an old index format — run: claude-grep --index\n", stats.Outdated)
+	}
+	fmt.Printf("size:     %s\n", formatSize(stats.SizeBytes))
+	fmt.Printf("trigrams: %d files, %s\n", stats.TrigramFiles, formatSize(stats.TrigramBytes))
+	fmt.Printf("keywords: %d files, %d messages, %s\n", stats.KeywordFiles, stats.KeywordMessages, formatSize(stats.KeywordBytes))
 }
 
-type embedResponse struct {
-	Embeddings [][]float32 `json:"embeddings"`
+// entryKey identifies a message within its session file.
+type entryKey struct {
+	uuid  string
+	block int
 }
 
-func embed(text string) ([]float32, error) {
-	body, err := json.Marshal(embedRequest{Model: embedModel, Input: text})
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := http.Post(ollamaURL, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("ollama request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("ollama returned %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var result embedResponse
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, err
-	}
-
-	if len(result.Embeddings) == 0 {
-		return nil, fmt.Errorf("no embeddings returned")
+// entryVectors maps the uuid-keyed entries of a file to their vectors.
+func entryVectors(entries []IndexEntry, fpath string) map[entryKey][]float32 {
+	vecs := make(map[entryKey][]float32)
+	for _, e := range entries {
+		if e.FilePath == fpath && e.UUID != "" {
+			vecs[entryKey{e.UUID, e.Block}] = e.Vector
+		}
 	}
+	return vecs
+}
 
-	return result.Embeddings[0], nil
+// entriesLackUUID reports whether any of fpath's entries has no uuid.
+func entriesLackUUID(entries []IndexEntry, fpath string) bool {
+	return slices.ContainsFunc(entries, func(e IndexEntry) bool { return e.FilePath == fpath && e.UUID == "" })
 }
 
-func ollamaReachable() bool {
-	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get("http://localhost:11434/")
-	if err != nil {
-		return false
+func removeEntriesForFile(entries []IndexEntry, fpath string) []IndexEntry {
+	var kept []IndexEntry
+	for _, e := range entries {
+		if e.FilePath != fpath {
+			kept = append(kept, e)
+		}
 	}
-	resp.Body.Close()
-	return resp.StatusCode == 200
+	return kept
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunIndexReembedsEntriesWithoutUUID(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_GREP_EMBEDDER", "builtin")
+	dir := filepath.Join(home, ".claude", "projects", "proj")
+	os.MkdirAll(dir, 0755)
+	withUUID := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(withUUID, []byte(`{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"fix the invoice rounding bug"}}
+`), 0644)
+	noUUID := filepath.Join(dir, "bbbb.jsonl")
+	os.WriteFile(noUUID, []byte(`{"type":"user","timestamp":"2025-01-02T11:00:00Z","message":{"content":"deploy the staging cluster"}}
+`), 0644)
+
+	// An unchanged file whose entry predates uuids, as left by an old index
+	e, _ := newEmbedder()
+	info, _ := os.Stat(withUUID)
+	saveIndex(&Index{
+		Project:  "proj",
+		Files:    map[string]FileMetadata{withUUID: {FilePath: withUUID, LastModified: info.ModTime()}},
+		Entries:  []IndexEntry{{FilePath: withUUID, MsgIndex: 0, Preview: "stale"}},
+		Embedder: e.ID(),
+		Format:   indexFormat,
+	})
+
+	runIndex(false)
+	idx := loadIndex("proj")
+	if len(idx.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(idx.Entries))
+	}
+	for _, entry := range idx.Entries {
+		if entry.FilePath == withUUID && entry.UUID != "u1" {
+			t.Errorf("entry without uuid kept: %+v", entry)
+		}
+	}
+	if !idx.Files[noUUID].NoUUIDs || idx.Files[withUUID].NoUUIDs {
+		t.Errorf("NoUUIDs: %+v", idx.Files)
+	}
+
+	// A file with no uuids to give is not re-embedded on every run
+	for i := range idx.Entries {
+		idx.Entries[i].Preview = "marker"
+	}
+	saveIndex(idx)
+	runIndex(false)
+	for _, entry := range loadIndex("proj").Entries {
+		if entry.Preview != "marker" {
+			t.Errorf("unchanged file re-embedded: %+v", entry)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// lineBufSize is the read buffer for streaming JSONL. Lines longer than
+// this (pasted logs, big tool output) are assembled in a separate buffer
+// that grows to the longest line and is reused for the rest of the file.
+const lineBufSize = 64 * 1024
+
+// jsonlLine holds the fields of a session line the parser needs. Decoding
+// into typed structs skips everything else (toolUseResult copies, image
+// data, metadata) and decodes message text straight into strings instead
+// of copying it through intermediate json.RawMessage buffers.
+type jsonlLine struct {
+	Type        string       `json:"type"`
+	Timestamp   string       `json:"timestamp"`
+	UUID        string       `json:"uuid"`
+	ParentUUID  string       `json:"parentUuid"`
+	IsSidechain bool         `json:"isSidechain"`
+	Cwd         string       `json:"cwd"`
+	GitBranch   string       `json:"gitBranch"`
+	Version     string       `json:"version"`
+	Message     jsonlMessage `json:"message"`
+	Data        struct {
+		Message jsonlMessage `json:"message"`
+	} `json:"data"`
+}
+
+// jsonlSummary is a "summary" line: a session title pointing at the
+// leaf message it summarizes, which may live in another session file.
+type jsonlSummary struct {
+	Type     string `json:"type"`
+	Summary  string `json:"summary"`
+	LeafUUID string `json:"leafUuid"`
+}
+
+// jsonlLink is the conversation-tree part of a line, decoded for lines
+// that carry no searchable content (progress, system) so the chain of
+// parentUuid links stays unbroken.
+type jsonlLink struct {
+	UUID       string `json:"uuid"`
+	ParentUUID string `json:"parentUuid"`
+}
+
+// jsonlMessage is a line's message object. Lines whose message is not an
+// object decode without error and are marked invalid, so the parser can
+// fall back to data.message.
+type jsonlMessage struct {
+	Present bool
+	Invalid bool
+	Model   string
+	Content jsonlContent
+}
+
+func (m *jsonlMessage) UnmarshalJSON(b []byte) error {
+	m.Present = true
+	if len(b) == 0 || b[0] != '{' {
+		m.Invalid = string(b) != "null"
+		return nil
+	}
+	var obj struct {
+		Model   string       `json:"model"`
+		Content jsonlContent `json:"content"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		m.Invalid = true
+		return nil
+	}
+	m.Model = obj.Model
+	m.Content = obj.Content
+	return nil
+}
+
+// jsonlContent is message (or tool_result) content: either a plain string
+// or an array of content blocks.
+type jsonlContent struct {
+	Text   string
+	Blocks []jsonlBlock
+}
+
+func (c *jsonlContent) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &c.Text)
+	}
+	if len(b) > 0 && b[0] == '[' {
+		// Unknown block shapes are skipped, not fatal to the line
+		json.Unmarshal(b, &c.Blocks)
+	}
+	return nil
+}
+
+// jsonlBlock is one element of a content array.
+type jsonlBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   jsonlContent    `json:"content"`
+}
+
+// sessionParser turns session lines into messages one line at a time, so
+// a file can be parsed from a stream without holding its raw bytes.
+type sessionParser struct {
+	fpath       string
+	sessionID   string
+	project     string
+	messages    []Message
+	toolNames   map[string]string // tool_use ID → tool name
+	seenResults map[string]bool
+	seenLines   map[string]bool   // line uuids already parsed
+	parentOf    map[string]string // line uuid → parentUuid
+	lastMsg     map[string]int    // line uuid → MsgIndex of its last message
+	taskPrompts map[string]int    // Task prompt → MsgIndex of the Task call
+	summaries   []jsonlSummary
+}
+
+func newSessionParser(fpath string) *sessionParser {
+	return &sessionParser{
+		fpath:       fpath,
+		sessionID:   extractSessionID(fpath),
+		project:     extractProject(fpath),
+		toolNames:   make(map[string]string),
+		seenResults: make(map[string]bool),
+		seenLines:   make(map[string]bool),
+		parentOf:    make(map[string]string),
+		lastMsg:     make(map[string]int),
+		taskPrompts: make(map[string]int),
+	}
+}
+
+var (
+	userTypeLit      = []byte(`"user"`)
+	assistantTypeLit = []byte(`"assistant"`)
+	uuidLit          = []byte(`"uuid"`)
+	summaryLit       = []byte(`"summary"`)
+)
+
+// decodeLine unmarshals a session line into v. A field of an unexpected
+// type (a string "data", a numeric timestamp) is left empty rather than
+// costing the whole line, as it did with the old map-based parser; only
+// malformed JSON rejects a line.
+func decodeLine(line []byte, v any) error {
+	err := json.Unmarshal(line, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return nil
+	}
+	return err
+}
+
+// addLine parses one JSONL line. The line is not retained.
+func (p *sessionParser) addLine(line []byte) {
+	if len(line) == 0 {
+		return
+	}
+	// Cheap reject for progress/system/summary lines before decoding;
+	// only their tree links are kept
+	if !bytes.Contains(line, userTypeLit) && !bytes.Contains(line, assistantTypeLit) {
+		if bytes.Contains(line, summaryLit) {
+			var sum jsonlSummary
+			if decodeLine(line, &sum) == nil && sum.Type == "summary" && sum.Summary != "" {
+				p.summaries = append(p.summaries, sum)
+				return
+			}
+		}
+		if bytes.Contains(line, uuidLit) {
+			var link jsonlLink
+			if decodeLine(line, &link) == nil && link.UUID != "" {
+				p.parentOf[link.UUID] = link.ParentUUID
+			}
+		}
+		return
+	}
+
+	var l jsonlLine
+	if err := decodeLine(line, &l); err != nil {
+		return
+	}
+	if l.UUID != "" {
+		// A line's uuid is its identity: a repeat is a true duplicate
+		// (e.g. replayed on resume), never a new message
+		if p.seenLines[l.UUID] {
+			return
+		}
+		p.seenLines[l.UUID] = true
+		p.parentOf[l.UUID] = l.ParentUUID
+	}
+	msgType := l.Type
+	if msgType != "user" && msgType != "assistant" {
+		return
+	}
+
+	timestamp := l.Timestamp
+	if len(timestamp) > 19 {
+		timestamp = timestamp[:19]
+	}
+
+	// The first message of a line hangs off the parent line's last message;
+	// later blocks of the same line follow each other. Files without uuids
+	// fall back to file order.
+	parent := len(p.messages) - 1
+	if l.UUID != "" {
+		parent = p.resolveParent(l.ParentUUID)
+	}
+
+	// Get message content: prose plus any tool calls and results
+	for b, block := range extractBlocks(l) {
+		// Tool calls and results carry unique IDs — drop repeats
+		switch block.Kind {
+		case "tool_use":
+			if _, ok := p.toolNames[block.ID]; ok && block.ID != "" {
+				continue
+			}
+			p.toolNames[block.ID] = block.Tool
+		case "tool_result":
+			if p.seenResults[block.ID] && block.ID != "" {
+				continue
+			}
+			p.seenResults[block.ID] = true
+			block.Tool = p.toolNames[block.ID]
+		}
+
+		msg := Message{
+			Role:       msgType,
+			Type:       msgType,
+			Text:       block.Text,
+			Timestamp:  timestamp,
+			SessionID:  p.sessionID,
+			Project:    p.project,
+			FilePath:   p.fpath,
+			MsgIndex:   len(p.messages),
+			Kind:       block.Kind,
+			Tool:       block.Tool,
+			Target:     block.Target,
+			UUID:       l.UUID,
+			Block:      b,
+			ParentUUID: l.ParentUUID,
+			Sidechain:  l.IsSidechain,
+			Parent:     parent,
+			Cwd:        l.Cwd,
+			GitBranch:  l.GitBranch,
+			Version:    l.Version,
+			Model:      l.Message.Model,
+		}
+
+		// A subagent's opening prompt threads back to the Task call that
+		// spawned it, when both live in the same file
+		if l.IsSidechain && parent < 0 && msgType == "user" {
+			if i, ok := p.taskPrompts[block.Text]; ok {
+				msg.Parent = i
+			}
+		}
+
+		// Files without uuids: collapse prose with the same
+		// timestamp+role+kind, keeping the latest
+		if l.UUID == "" && (block.Kind == "text" || block.Kind == "thinking") && len(p.messages) > 0 {
+			prev := &p.messages[len(p.messages)-1]
+			if prev.Timestamp == timestamp && prev.Role == msgType && prev.Kind == block.Kind {
+				msg.MsgIndex = prev.MsgIndex
+				msg.Parent = prev.Parent
+				*prev = msg
+				parent = prev.MsgIndex
+				p.markLast(l.UUID, prev.MsgIndex)
+				continue
+			}
+		}
+
+		if block.Prompt != "" {
+			p.taskPrompts[block.Prompt] = msg.MsgIndex
+		}
+		p.messages = append(p.messages, msg)
+		parent = msg.MsgIndex
+		p.markLast(l.UUID, msg.MsgIndex)
+	}
+}
+
+func (p *sessionParser) markLast(uuid string, i int) {
+	if uuid != "" {
+		p.lastMsg[uuid] = i
+	}
+}
+
+// title picks the session title from its summary lines: the latest one
+// whose leaf is in this file, else the latest one (a continued session
+// opens with the summary of the conversation it resumes).
+func (p *sessionParser) title() string {
+	for i := len(p.summaries) - 1; i >= 0; i-- {
+		if _, ok := p.parentOf[p.summaries[i].LeafUUID]; ok {
+			return p.summaries[i].Summary
+		}
+	}
+	if len(p.summaries) > 0 {
+		return p.summaries[len(p.summaries)-1].Summary
+	}
+	return ""
+}
+
+// finish stamps session-level data on the parsed messages.
+func (p *sessionParser) finish() []Message {
+	if title := p.title(); title != "" {
+		for i := range p.messages {
+			p.messages[i].Title = title
+		}
+	}
+	return p.messages
+}
+
+// resolveParent walks up the parentUuid chain to the nearest line that
+// produced a message, skipping contentless lines, and returns its last
+// message index (-1 at the root).
+func (p *sessionParser) resolveParent(uuid string) int {
+	for depth := 0; uuid != "" && depth < 1000; depth++ {
+		if i, ok := p.lastMsg[uuid]; ok {
+			return i
+		}
+		uuid = p.parentOf[uuid]
+	}
+	return -1
+}
+
+// parseJSONLFile streams a session file into messages. Memory is bounded
+// by the longest line plus the extracted message text, not the file size.
+func parseJSONLFile(fpath string) ([]Message, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseJSONLReader(fpath, f)
+}
+
+func parseJSONLReader(fpath string, r io.Reader) ([]Message, error) {
+	p := newSessionParser(fpath)
+	err := readLines(r, p.addLine)
+	return p.finish(), err
+}
+
+// readLines calls fn for each line of r. The slice passed to fn is only
+// valid for the duration of the call.
+func readLines(r io.Reader, fn func(line []byte)) error {
+	br := bufio.NewReaderSize(r, lineBufSize)
+	var long []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long, chunk...)
+			continue
+		}
+		line := chunk
+		if len(long) > 0 {
+			long = append(long, chunk...)
+			line = long
+		}
+		fn(bytes.TrimRight(line, "\r\n"))
+		long = long[:0]
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// contentBlock is one searchable piece of a message line.
+type contentBlock struct {
+	Kind string // "text", "thinking", "tool_use" or "tool_result"
+	Tool string // tool name, tool_use only
+	ID   string // tool_use ID (tool_use_id for results), used for dedup
+	Text string
+	// Target is the file path a file tool operated on, tool_use only
+	Target string
+	// Prompt is the prompt of a Task (subagent) call, used for threading
+	Prompt string
+}
+
+// extractBlocks pulls searchable content from the message field (or
+// data.message when message is not an object): the thinking and prose
+// text (each joined into one block) followed by one block per tool call
+// or tool result.
+func extractBlocks(l jsonlLine) []contentBlock {
+	msg := l.Message
+	if !msg.Present {
+		return nil
+	}
+	if msg.Invalid {
+		msg = l.Data.Message
+	}
+	content := msg.Content
+
+	// Plain string content
+	if content.Blocks == nil {
+		if text := strings.TrimSpace(content.Text); text != "" {
+			return []contentBlock{{Kind: "text", Text: text}}
+		}
+		return nil
+	}
+
+	// Array of content blocks
+	var texts, thoughts []string
+	var tools []contentBlock
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				texts = append(texts, block.Text)
+			}
+		case "thinking":
+			if block.Thinking != "" {
+				thoughts = append(thoughts, block.Thinking)
+			}
+		case "tool_use":
+			text := toolInputText(block.Input)
+			if block.Name == "" || text == "" {
+				continue
+			}
+			tools = append(tools, contentBlock{
+				Kind: "tool_use", Tool: block.Name, ID: block.ID, Text: text,
+				Target: toolTarget(block.Input),
+				Prompt: taskPrompt(block.Name, block.Input),
+			})
+		case "tool_result":
+			text := toolResultText(block.Content)
+			if text == "" {
+				continue
+			}
+			tools = append(tools, contentBlock{Kind: "tool_result", ID: block.ToolUseID, Text: text})
+		}
+	}
+
+	var out []contentBlock
+	if text := strings.TrimSpace(strings.Join(thoughts, " ")); text != "" {
+		out = append(out, contentBlock{Kind: "thinking", Text: text})
+	}
+	if text := strings.TrimSpace(strings.Join(texts, " ")); text != "" {
+		out = append(out, contentBlock{Kind: "text", Text: text})
+	}
+	return append(out, tools...)
+}
+
+// toolResultText extracts the text of a tool_result block, whose content
+// is either a plain string or an array of text (and image) blocks.
+func toolResultText(content jsonlContent) string {
+	if content.Blocks == nil {
+		return strings.TrimSpace(content.Text)
+	}
+	var texts []string
+	for _, b := range content.Blocks {
+		if b.Type == "text" && b.Text != "" {
+			texts = append(texts, b.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
+}
+
+// toolTarget returns the file path from a file tool's input (file_path
+// for Read/Edit/MultiEdit/Write, notebook_path for NotebookEdit).
+func toolTarget(input json.RawMessage) string {
+	var in struct {
+		FilePath     string `json:"file_path"`
+		NotebookPath string `json:"notebook_path"`
+	}
+	if err := json.Unmarshal(input, &in); err != nil {
+		return ""
+	}
+	if in.FilePath != "" {
+		return in.FilePath
+	}
+	return in.NotebookPath
+}
+
+// taskPrompt returns the prompt of a Task (or Agent) call, which becomes
+// the first user message of the subagent's sidechain.
+func taskPrompt(tool string, input json.RawMessage) string {
+	if tool != "Task" && tool != "Agent" {
+		return ""
+	}
+	var in struct {
+		Prompt string `json:"prompt"`
+	}
+	json.Unmarshal(input, &in)
+	return strings.TrimSpace(in.Prompt)
+}
+
+// toolInputKeys are tool_use input fields shown first, so a Bash call
+// reads as its command and an Edit as its file path.
+var toolInputKeys = []string{"command", "file_path", "path", "pattern", "url", "query", "prompt", "description"}
+
+// toolInputText flattens a tool_use input object into searchable text.
+// String values are used as-is; nested values are kept as compact JSON.
+func toolInputText(input json.RawMessage) string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(input, &obj); err != nil {
+		return strings.TrimSpace(string(input))
+	}
+
+	var keys []string
+	for _, k := range toolInputKeys {
+		if _, ok := obj[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range obj {
+		if !slices.Contains(toolInputKeys, k) {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	var parts []string
+	for _, k := range keys {
+		var s string
+		if err := json.Unmarshal(obj[k], &s); err == nil {
+			s = strings.TrimSpace(s)
+		} else {
+			s = string(obj[k])
+		}
+		if s != "" && s != "null" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseJSONL parses in-memory JSONL data into messages, splitting lines
+// itself rather than through readLines.
+func parseJSONL(fpath string, data []byte) []Message {
+	p := newSessionParser(fpath)
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		p.addLine(line)
+	}
+	return p.finish()
+}
+
+func TestParseJSONLToolUse(t *testing.T) {
+	data := []byte(`{"type":"user","timestamp":"2025-01-01T12:00:00.000Z","message":{"role":"user","content":"run the migration"}}
+{"type":"assistant","timestamp":"2025-01-01T12:00:01.000Z","message":{"role":"assistant","content":[{"type":"text","text":"Running it now."},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"make migrate","description":"apply migrations"}}]}}
+{"type":"assistant","timestamp":"2025-01-01T12:00:01.500Z","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"make migrate"}}]}}
+{"type":"assistant","timestamp":"2025-01-01T12:00:02.000Z","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"Edit","input":{"file_path":"/src/db.go","old_string":"a","new_string":"b"}}]}}
+`)
+	msgs := parseJSONL("/p/proj/session.jsonl", data)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(msgs), msgs)
+	}
+
+	want := []struct{ kind, tool, text string }{
+		{"text", "", "run the migration"},
+		{"text", "", "Running it now."},
+		{"tool_use", "Bash", "make migrate apply migrations"},
+		{"tool_use", "Edit", "/src/db.go b a"},
+	}
+	for i, w := range want {
+		m := msgs[i]
+		if m.Kind != w.kind || m.Tool != w.tool || m.Text != w.text {
+			t.Errorf("[%d]: got %s/%s %q, want %s/%s %q", i, m.Kind, m.Tool, m.Text, w.kind, w.tool, w.text)
+		}
+		if m.MsgIndex != i {
+			t.Errorf("[%d]: MsgIndex = %d", i, m.MsgIndex)
+		}
+	}
+}
+
+func TestParseJSONLToolResult(t *testing.T) {
+	data := []byte(`{"type":"assistant","timestamp":"2025-01-01T12:00:00.000Z","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go test ./..."}}]}}
+{"type":"user","timestamp":"2025-01-01T12:00:05.000Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"--- FAIL: TestFoo\nFAIL"}]}}
+{"type":"user","timestamp":"2025-01-01T12:00:06.000Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_2","content":[{"type":"text","text":"file contents"}]}]}}
+{"type":"user","timestamp":"2025-01-01T12:00:07.000Z","message":{"role":"user","content":"why does it fail?"}}
+`)
+	msgs := parseJSONL("/p/proj/session.jsonl", data)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(msgs), msgs)
+	}
+	if msgs[1].Kind != "tool_result" || msgs[1].Tool != "Bash" || msgs[1].Text != "--- FAIL: TestFoo\nFAIL" {
+		t.Errorf("string result: got %+v", msgs[1])
+	}
+	if msgs[2].Kind != "tool_result" || msgs[2].Tool != "" || msgs[2].Text != "file contents" {
+		t.Errorf("block result: got %+v", msgs[2])
+	}
+
+	roles := []struct {
+		role string
+		want []int
+	}{
+		{"both", []int{0, 3}},
+		{"user", []int{3}},
+		{"assistant", []int{0}},
+		{"tool", []int{1, 2}},
+	}
+	for _, r := range roles {
+		opts := SearchOpts{Role: r.role}
+		var got []int
+		for i, m := range msgs {
+			if opts.accepts(m) {
+				got = append(got, i)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(r.want) {
+			t.Errorf("role %s: accepted %v, want %v", r.role, got, r.want)
+		}
+	}
+}
+
+func TestParseJSONLThinking(t *testing.T) {
+	data := []byte(`{"type":"assistant","timestamp":"2025-01-01T12:00:00.000Z","message":{"role":"assistant","content":[{"type":"thinking","thinking":"retry is safer than a lock here","signature":"x"},{"type":"text","text":"Use a retry."}]}}
+`)
+	msgs := parseJSONL("/p/proj/session.jsonl", data)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	if msgs[0].Kind != "thinking" || msgs[0].Text != "retry is safer than a lock here" {
+		t.Errorf("thinking block: got %+v", msgs[0])
+	}
+	if (SearchOpts{Role: "both"}).accepts(msgs[0]) {
+		t.Error("thinking should be excluded by default")
+	}
+	if !(SearchOpts{Role: "assistant", Thinking: true}).accepts(msgs[0]) {
+		t.Error("--thinking should include thinking blocks")
+	}
+	if (SearchOpts{Role: "user", Thinking: true}).accepts(msgs[0]) {
+		t.Error("-p should exclude thinking blocks")
+	}
+}
+
+func TestParseJSONLReaderLongLines(t *testing.T) {
+	big := strings.Repeat("log line with noise ", lineBufSize/10) // several buffers long
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\"type\":\"user\",\"timestamp\":\"2025-01-01T12:00:00Z\",\"message\":{\"content\":\"first\"}}\r\n")
+	fmt.Fprintf(&buf, "{\"type\":\"progress\",\"data\":{\"message\":{\"content\":\"skipped\"}}}\n")
+	fmt.Fprintf(&buf, "{\"type\":\"assistant\",\"timestamp\":\"2025-01-01T12:00:01Z\",\"message\":{\"content\":[{\"type\":\"text\",\"text\":%q}]}}\n", big)
+	fmt.Fprintf(&buf, "{\"type\":\"user\",\"timestamp\":\"2025-01-01T12:00:02Z\",\"message\":{\"content\":\"last, no newline\"}}")
+
+	want := parseJSONL("/p/proj/s.jsonl", buf.Bytes())
+	got, err := parseJSONLReader("/p/proj/s.jsonl", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || len(want) != 3 {
+		t.Fatalf("got %d streamed / %d in-memory messages, want 3", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("[%d]: streamed %+v differs from in-memory", i, got[i].Timestamp)
+		}
+	}
+	if got[1].Text != strings.TrimSpace(big) {
+		t.Errorf("long line text truncated: %d bytes", len(got[1].Text))
+	}
+}
+
+func TestPrefilterReaderChunkBoundaries(t *testing.T) {
+	// Literal and a multi-byte rune straddle every possible chunk split
+	data := []byte(strings.Repeat("x", 100) + "ÜBER Deploy" + strings.Repeat("y", 100))
+	for _, lit := range []string{"über deploy", "deploy"} {
+		for split := 1; split < len(data); split++ {
+			m := newFoldMatcher([][]byte{[]byte(lit)})
+			found := m.write(data[:split]) || m.write(data[split:])
+			if !found {
+				t.Fatalf("%q not found with split at %d", lit, split)
+			}
+		}
+	}
+	for _, lit := range []string{"ÜBER Deploy", "y"} {
+		for split := 1; split < len(data); split++ {
+			m := newExactMatcher([][]byte{[]byte(lit)})
+			found := m.write(data[:split]) || m.write(data[split:])
+			if !found {
+				t.Fatalf("exact %q not found with split at %d", lit, split)
+			}
+		}
+	}
+	// Exact literals don't fold, and short chunks still carry the seam
+	if m := newExactMatcher([][]byte{[]byte("über deploy")}); m.write(data) {
+		t.Error("exact matcher folded case")
+	}
+	m := newExactMatcher([][]byte{[]byte("Deploy")})
+	found := false
+	for _, c := range []byte("xxDeployxx") {
+		found = found || m.write([]byte{c})
+	}
+	if !found {
+		t.Error("exact literal fed a byte at a time not found")
+	}
+
+	ok, err := prefilterReader(bytes.NewReader(data), [][]byte{[]byte("zzz")})
+	if err != nil || ok {
+		t.Errorf("absent literal: got %v, %v", ok, err)
+	}
+}
+
+// benchSession writes a synthetic session with pasted logs and big tool
+// output — the shape that made whole-file parsing expensive.
+func benchSession(b *testing.B) string {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "proj", "bench.jsonl")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	logs := strings.Repeat("2025-01-01 12:00:00 INFO worker processed batch id=42 status=ok\n", 2000)
+	enc := json.NewEncoder(f)
+	for i := 0; i < 100; i++ {
+		ts := fmt.Sprintf("2025-01-01T12:%02d:%02dZ", i/60, i%60)
+		enc.Encode(map[string]any{"type": "user", "timestamp": ts, "message": map[string]any{"content": "please check the deploy logs " + logs[:200]}})
+		enc.Encode(map[string]any{"type": "assistant", "timestamp": ts, "message": map[string]any{"content": []any{
+			map[string]any{"type": "text", "text": "Looking at it."},
+			map[string]any{"type": "tool_use", "id": fmt.Sprint("toolu_", i), "name": "Bash", "input": map[string]any{"command": "kubectl logs deploy/api"}},
+		}}})
+		enc.Encode(map[string]any{"type": "user", "timestamp": ts, "toolUseResult": logs, "message": map[string]any{"content": []any{
+			map[string]any{"type": "tool_result", "tool_use_id": fmt.Sprint("toolu_", i), "content": logs},
+		}}})
+	}
+	return path
+}
+
+// legacyParseJSONL is how a search read a file before streaming
+// (searchFileTracked at the baseline): read it whole, lowercase a full
+// copy for the prefilter, then parse with the old map-based parser.
+func legacyParseJSONL(path string, literals [][]byte) []Message {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if !baselinePrefilterMatch(data, literals) {
+		return nil
+	}
+	return baselineParseJSONL(path, data)
+}
+
+// baselinePrefilterMatch, baselineParseJSONL and baselineExtractText are
+// the baseline prefilterMatch, parseJSONL and extractText, verbatim but
+// for their names.
+func baselinePrefilterMatch(data []byte, literals [][]byte) bool {
+	if len(literals) == 0 {
+		return true
+	}
+	lower := bytes.ToLower(data)
+	for _, lit := range literals {
+		if bytes.Contains(lower, lit) {
+			return true
+		}
+	}
+	return false
+}
+
+func baselineParseJSONL(fpath string, data []byte) []Message {
+	sessionID := extractSessionID(fpath)
+	project := extractProject(fpath)
+
+	var messages []Message
+	idx := 0
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(line, &raw); err != nil {
+			continue
+		}
+
+		// Get type field
+		var msgType string
+		if t, ok := raw["type"]; ok {
+			json.Unmarshal(t, &msgType)
+		}
+		if msgType != "user" && msgType != "assistant" {
+			continue
+		}
+
+		// Get timestamp
+		var timestamp string
+		if ts, ok := raw["timestamp"]; ok {
+			json.Unmarshal(ts, &timestamp)
+			if len(timestamp) > 19 {
+				timestamp = timestamp[:19]
+			}
+		}
+
+		// Get message content
+		text := baselineExtractText(raw)
+		if text == "" {
+			continue
+		}
+
+		msg := Message{
+			Role:      msgType,
+			Type:      msgType,
+			Text:      text,
+			Timestamp: timestamp,
+			SessionID: sessionID,
+			Project:   project,
+			FilePath:  fpath,
+			MsgIndex:  idx,
+		}
+
+		// Deduplicate: same timestamp+role → keep latest
+		if len(messages) > 0 {
+			prev := &messages[len(messages)-1]
+			if prev.Timestamp == timestamp && prev.Role == msgType {
+				*prev = msg
+				continue
+			}
+		}
+
+		messages = append(messages, msg)
+		idx++
+	}
+
+	// Fix MsgIndex after dedup
+	for i := range messages {
+		messages[i].MsgIndex = i
+	}
+
+	return messages
+}
+
+func baselineExtractText(raw map[string]json.RawMessage) string {
+	// Try message.content first
+	var msgObj map[string]json.RawMessage
+	if m, ok := raw["message"]; ok {
+		if err := json.Unmarshal(m, &msgObj); err != nil {
+			// Try data.message
+			if d, ok := raw["data"]; ok {
+				var dataObj map[string]json.RawMessage
+				if err := json.Unmarshal(d, &dataObj); err == nil {
+					if dm, ok := dataObj["message"]; ok {
+						json.Unmarshal(dm, &msgObj)
+					}
+				}
+			}
+		}
+	}
+
+	if msgObj == nil {
+		return ""
+	}
+
+	contentRaw, ok := msgObj["content"]
+	if !ok {
+		return ""
+	}
+
+	// Try as string
+	var strContent string
+	if err := json.Unmarshal(contentRaw, &strContent); err == nil {
+		return strings.TrimSpace(strContent)
+	}
+
+	// Try as array of content blocks
+	var blocks []map[string]json.RawMessage
+	if err := json.Unmarshal(contentRaw, &blocks); err == nil {
+		var texts []string
+		for _, block := range blocks {
+			var blockType string
+			if t, ok := block["type"]; ok {
+				json.Unmarshal(t, &blockType)
+			}
+			if blockType != "text" {
+				continue
+			}
+			var text string
+			if t, ok := block["text"]; ok {
+				json.Unmarshal(t, &text)
+			}
+			if text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.TrimSpace(strings.Join(texts, " "))
+	}
+
+	return ""
+}
+
+func TestParseJSONLMistypedFields(t *testing.T) {
+	// Each line has one field of an unexpected type; the baseline parser
+	// kept them all, and so must this one. The last line is not JSON.
+	data := []byte(`{"type":"user","uuid":"u1","timestamp":1735732800,"message":{"content":"numeric timestamp"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01Z","data":"hook output","message":{"content":[{"type":"text","text":"string data"}]}}
+{"type":"user","uuid":"u2","parentUuid":"a1","isSidechain":"no","cwd":42,"timestamp":"2025-01-01T12:00:02Z","message":{"content":"odd sidechain and cwd"}}
+{"type":"user","uuid":"u3","message":{"content":"truncated
+`)
+	var got, want []string
+	for _, m := range parseJSONL("/p/proj/s.jsonl", data) {
+		got = append(got, m.Text)
+	}
+	for _, m := range baselineParseJSONL("/p/proj/s.jsonl", data) {
+		want = append(want, m.Text)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != 3 {
+		t.Errorf("got %q, baseline parser got %q", got, want)
+	}
+}
+
+func BenchmarkParseJSONLLegacy(b *testing.B) {
+	path := benchSession(b)
+	literals := [][]byte{[]byte("rollback")} // absent until the last byte: worst case
+	b.ReportAllocs()
+	for b.Loop() {
+		legacyParseJSONL(path, append(literals, []byte("deploy")))
+	}
+}
+
+func BenchmarkParseJSONLStream(b *testing.B) {
+	path := benchSession(b)
+	literals := [][]byte{[]byte("rollback"), []byte("deploy")}
+	b.ReportAllocs()
+	for b.Loop() {
+		f, _ := os.Open(path)
+		if ok, _ := prefilterReader(f, literals); ok {
+			f.Seek(0, 0)
+			parseJSONLReader(path, f)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkPrefilterLegacy(b *testing.B) {
+	path := benchSession(b)
+	literals := [][]byte{[]byte("rollback")}
+	b.ReportAllocs()
+	for b.Loop() {
+		legacyParseJSONL(path, literals)
+	}
+}
+
+func BenchmarkPrefilterStream(b *testing.B) {
+	path := benchSession(b)
+	literals := [][]byte{[]byte("rollback")}
+	b.ReportAllocs()
+	for b.Loop() {
+		f, _ := os.Open(path)
+		prefilterReader(f, literals)
+		f.Close()
+	}
+}
+
+func TestParseJSONLConversationTree(t *testing.T) {
+	data := []byte(`{"type":"user","uuid":"u1","parentUuid":null,"timestamp":"2025-01-01T12:00:00Z","message":{"content":"audit the deps"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01Z","message":{"content":[{"type":"text","text":"Delegating."},{"type":"tool_use","id":"t1","name":"Task","input":{"description":"audit","prompt":"List outdated deps"}}]}}
+{"type":"user","uuid":"s1","parentUuid":null,"isSidechain":true,"timestamp":"2025-01-01T12:00:02Z","message":{"content":"List outdated deps"}}
+{"type":"progress","uuid":"p1","parentUuid":"s1","timestamp":"2025-01-01T12:00:03Z","data":{"type":"hook"}}
+{"type":"assistant","uuid":"s2","parentUuid":"p1","isSidechain":true,"timestamp":"2025-01-01T12:00:04Z","message":{"content":[{"type":"text","text":"lodash is outdated"}]}}
+{"type":"user","uuid":"r1","parentUuid":"a1","timestamp":"2025-01-01T12:00:05Z","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"lodash is outdated"}]}}
+`)
+	msgs := parseJSONL("/p/proj/s.jsonl", data)
+	if len(msgs) != 6 {
+		t.Fatalf("got %d messages, want 6", len(msgs))
+	}
+	// u1 → a1 text → a1 Task → s1 (threaded via prompt) → s2 (through progress line); r1 → Task
+	wantParent := []int{-1, 0, 1, 2, 3, 2}
+	for i, want := range wantParent {
+		if msgs[i].Parent != want {
+			t.Errorf("[%d] %q: Parent = %d, want %d", i, msgs[i].Text, msgs[i].Parent, want)
+		}
+	}
+	if !msgs[3].Sidechain || !msgs[4].Sidechain || msgs[5].Sidechain {
+		t.Errorf("sidechain flags wrong: %v %v %v", msgs[3].Sidechain, msgs[4].Sidechain, msgs[5].Sidechain)
+	}
+	if msgs[4].UUID != "s2" || msgs[4].ParentUUID != "p1" {
+		t.Errorf("uuid fields: got %q/%q", msgs[4].UUID, msgs[4].ParentUUID)
+	}
+}
+
+func TestParseJSONLNoUUIDFallsBackToFileOrder(t *testing.T) {
+	data := []byte(`{"type":"user","timestamp":"2025-01-01T12:00:00Z","message":{"content":"one"}}
+{"type":"assistant","timestamp":"2025-01-01T12:00:01Z","message":{"content":"two"}}
+`)
+	msgs := parseJSONL("/p/proj/s.jsonl", data)
+	if len(msgs) != 2 || msgs[0].Parent != -1 || msgs[1].Parent != 0 {
+		t.Errorf("want file-order parents, got %+v", msgs)
+	}
+}
+
+func TestParseJSONLUUIDIdentity(t *testing.T) {
+	// a1 and a2 are separate blocks streamed within the same second;
+	// a1 repeated is a true duplicate
+	head := `{"type":"user","uuid":"u1","timestamp":"2025-01-01T12:00:00.100Z","message":{"content":"plan it"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01.200Z","message":{"content":[{"type":"text","text":"First, the schema."}]}}
+{"type":"assistant","uuid":"a2","parentUuid":"a1","timestamp":"2025-01-01T12:00:01.900Z","message":{"content":[{"type":"text","text":"Then the migration."}]}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01.200Z","message":{"content":[{"type":"text","text":"First, the schema."}]}}
+`
+	msgs := parseJSONL("/p/proj/s.jsonl", []byte(head))
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3: %+v", len(msgs), msgs)
+	}
+	if msgs[1].UUID != "a1" || msgs[2].UUID != "a2" {
+		t.Errorf("uuids: got %q, %q", msgs[1].UUID, msgs[2].UUID)
+	}
+
+	// Appending to the file keeps every earlier message where it was
+	grown := head + `{"type":"user","uuid":"u2","parentUuid":"a2","timestamp":"2025-01-01T12:00:01.950Z","message":{"content":"ok"}}
+{"type":"assistant","uuid":"a3","parentUuid":"u2","timestamp":"2025-01-01T12:00:02Z","message":{"content":[{"type":"text","text":"Done."},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"make migrate"}}]}}
+`
+	after := parseJSONL("/p/proj/s.jsonl", []byte(grown))
+	if len(after) != 6 {
+		t.Fatalf("got %d messages after append, want 6", len(after))
+	}
+	for i, m := range msgs {
+		if after[i].MsgIndex != m.MsgIndex || after[i].UUID != m.UUID || after[i].Text != m.Text {
+			t.Errorf("[%d] changed after append: %+v → %+v", i, m, after[i])
+		}
+	}
+	if after[5].UUID != "a3" || after[5].Block != 1 || after[4].Block != 0 {
+		t.Errorf("blocks of a3: got %q/%d, %q/%d", after[4].UUID, after[4].Block, after[5].UUID, after[5].Block)
+	}
+}
+
+func TestParseJSONLSummaryTitle(t *testing.T) {
+	data := []byte(`{"type":"summary","summary":"Earlier session","leafUuid":"elsewhere"}
+{"type":"summary","summary":"Fixing invoice rounding","leafUuid":"a1"}
+{"type":"user","uuid":"u1","timestamp":"2025-01-01T12:00:00Z","message":{"content":"fix rounding"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01Z","message":{"content":"done"}}
+`)
+	p := newSessionParser("/p/proj/s.jsonl")
+	readLines(bytes.NewReader(data), p.addLine)
+	msgs := p.finish()
+	if len(msgs) != 2 {
+		t.Fatalf("summary lines should not become messages: got %d", len(msgs))
+	}
+	if msgs[0].Title != "Fixing invoice rounding" {
+		t.Errorf("title: got %q", msgs[0].Title)
+	}
+}
+
+func TestParseJSONLLineMetadata(t *testing.T) {
+	data := []byte(`{"type":"user","uuid":"u1","cwd":"/src/api","gitBranch":"feat/payments","version":"1.0.80","timestamp":"2025-01-01T12:00:00Z","message":{"content":"hi"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-01T12:00:01Z","message":{"model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"hello"}]}}
+`)
+	msgs := parseJSONL("/p/proj/s.jsonl", data)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages", len(msgs))
+	}
+	if m := msgs[0]; m.Cwd != "/src/api" || m.GitBranch != "feat/payments" || m.Version != "1.0.80" {
+		t.Errorf("metadata: got cwd=%q branch=%q version=%q", m.Cwd, m.GitBranch, m.Version)
+	}
+	if msgs[0].Model != "" || msgs[1].Model != "claude-sonnet-4-5-20250929" {
+		t.Errorf("model: got %q, %q", msgs[0].Model, msgs[1].Model)
+	}
+}
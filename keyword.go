@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The keyword index is an inverted index of each session's messages over
+// the tokens BM25 compression uses (tokenizeWithBigrams): stemmed words
+// and adjacent word pairs. Keyword search (-k) ranks every message in
+// scope by BM25 against it, so a natural query like "flaky payment
+// webhook test" finds messages with most of those words, best first,
+// where a regex would need them as one literal phrase.
+
+// KeywordFile is the keyword index of one session file.
+type KeywordFile struct {
+	Size     int64
+	ModTime  time.Time
+	Title    string
+	Entries  []IndexEntry         // messages with at least one token, without vectors
+	Lengths  []int                // token count of each entry
+	Postings map[string][]Posting // token → entries containing it
+}
+
+// Posting records how often a token occurs in an entry.
+type Posting struct {
+	Entry int // index into KeywordFile.Entries
+	Freq  int
+}
+
+// KeywordIndex is one project's shard of the keyword index.
+type KeywordIndex struct {
+	Project string
+	Files   map[string]KeywordFile // keyed by filepath
+}
+
+func keywordDir() string {
+	return filepath.Join(indexDir(), "keyword")
+}
+
+func keywordPath(project string) string {
+	return filepath.Join(keywordDir(), project+".gob")
+}
+
+func loadKeywordIndex(project string) *KeywordIndex {
+	idx := &KeywordIndex{Project: project, Files: make(map[string]KeywordFile)}
+	f, err := os.Open(keywordPath(project))
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		return &KeywordIndex{Project: project, Files: make(map[string]KeywordFile)}
+	}
+	return idx
+}
+
+func saveKeywordIndex(idx *KeywordIndex) error {
+	if err := os.MkdirAll(keywordDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(keywordPath(idx.Project))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(idx)
+}
+
+// updateKeywordIndex brings a project's shard up to date with its session
+// files, re-reading only those whose size or modification time changed.
+// It returns how many files were indexed and how many were unchanged.
+func updateKeywordIndex(project string, files []string, reindexAll bool) (indexed, unchanged int, err error) {
+	idx := loadKeywordIndex(project)
+	if reindexAll {
+		idx.Files = make(map[string]KeywordFile)
+	}
+
+	present := make(map[string]bool, len(files))
+	for _, fpath := range files {
+		present[fpath] = true
+		info, err := os.Stat(fpath)
+		if err != nil {
+			continue
+		}
+		if kf, ok := idx.Files[fpath]; ok && kf.Size == info.Size() && kf.ModTime.Equal(info.ModTime()) {
+			unchanged++
+			continue
+		}
+		kf, err := buildKeywordFile(fpath, info)
+		if err != nil {
+			continue
+		}
+		idx.Files[fpath] = kf
+		indexed++
+	}
+	// Forget deleted sessions
+	for fpath := range idx.Files {
+		if !present[fpath] {
+			delete(idx.Files, fpath)
+		}
+	}
+	return indexed, unchanged, saveKeywordIndex(idx)
+}
+
+// buildKeywordFile tokenizes every message of a session file.
+func buildKeywordFile(fpath string, info os.FileInfo) (KeywordFile, error) {
+	messages, err := parseJSONLFile(fpath)
+	if err != nil {
+		return KeywordFile{}, err
+	}
+	kf := KeywordFile{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Postings: make(map[string][]Posting),
+	}
+	for _, msg := range messages {
+		if kf.Title == "" {
+			kf.Title = msg.Title
+		}
+		tokens := tokenizeWithBigrams(msg.Text)
+		if len(tokens) == 0 {
+			continue
+		}
+		freq := make(map[string]int)
+		for _, t := range tokens {
+			freq[t]++
+		}
+		entry := len(kf.Entries)
+		for t, n := range freq {
+			kf.Postings[t] = append(kf.Postings[t], Posting{Entry: entry, Freq: n})
+		}
+		kf.Entries = append(kf.Entries, newIndexEntry(msg))
+		kf.Lengths = append(kf.Lengths, len(tokens))
+	}
+	return kf, nil
+}
+
+// loadKeywordFiles returns the keyword index of each session file, from
+// the index where it is up to date and tokenized on the fly otherwise,
+// so keyword search works before the first --index.
+func loadKeywordFiles(files []string) map[string]*KeywordFile {
+	out := make(map[string]*KeywordFile, len(files))
+	shards := make(map[string]*KeywordIndex)
+	var stale []string
+	for _, fpath := range files {
+		project := indexProject(fpath)
+		idx, ok := shards[project]
+		if !ok {
+			idx = loadKeywordIndex(project)
+			shards[project] = idx
+		}
+		if kf, ok := idx.Files[fpath]; ok {
+			if info, err := os.Stat(fpath); err == nil && kf.Size == info.Size() && kf.ModTime.Equal(info.ModTime()) {
+				out[fpath] = &kf
+				continue
+			}
+		}
+		stale = append(stale, fpath)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for _, fpath := range stale {
+		wg.Add(1)
+		go func(fp string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			info, err := os.Stat(fp)
+			if err != nil {
+				return
+			}
+			kf, err := buildKeywordFile(fp, info)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			out[fp] = &kf
+			mu.Unlock()
+		}(fpath)
+	}
+	wg.Wait()
+	return out
+}
+
+// keywordSearch ranks the messages in scope that pass the filters by BM25
+// against the query's tokens and returns the best opts.MaxResults, each
+// with its score. Corpus statistics (document count, average length and
+// document frequencies) are taken over those same messages.
+func keywordSearch(query, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range tokenizeWithBigrams(query) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, SearchStats{}, fmt.Errorf("no keywords in %q — only stop words or single letters", query)
+	}
+
+	files, conversations, err := searchScope(searchPath, opts)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+	kfs := loadKeywordFiles(files)
+	stats := SearchStats{FilesTotal: len(files)}
+
+	// Messages passing the filters make up the corpus
+	accepted := make(map[string][]bool, len(kfs))
+	n, totalLen := 0, 0
+	df := make(map[string]int, len(terms))
+	for fpath, kf := range kfs {
+		acc := make([]bool, len(kf.Entries))
+		for i, e := range kf.Entries {
+			if opts.accepts(e.message()) {
+				acc[i] = true
+				n++
+				totalLen += kf.Lengths[i]
+			}
+		}
+		accepted[fpath] = acc
+		for _, t := range terms {
+			for _, p := range kf.Postings[t] {
+				if acc[p.Entry] {
+					df[t]++
+				}
+			}
+		}
+	}
+	if n == 0 {
+		return nil, stats, nil
+	}
+	avgDL := float64(totalLen) / float64(n)
+
+	type hit struct {
+		fpath string
+		entry int
+		score float64
+	}
+	var hits []hit
+	for fpath, kf := range kfs {
+		acc := accepted[fpath]
+		scores := make(map[int]float64)
+		for _, t := range terms {
+			if df[t] == 0 {
+				continue
+			}
+			// IDF: log((N - df + 0.5) / (df + 0.5) + 1)
+			idf := math.Log((float64(n)-float64(df[t])+0.5)/(float64(df[t])+0.5) + 1)
+			for _, p := range kf.Postings[t] {
+				if !acc[p.Entry] {
+					continue
+				}
+				f := float64(p.Freq)
+				dl := float64(kf.Lengths[p.Entry])
+				scores[p.Entry] += idf * (f * (bm25K1 + 1)) / (f + bm25K1*(1-bm25B+bm25B*dl/avgDL))
+			}
+		}
+		for i, s := range scores {
+			hits = append(hits, hit{fpath, i, s})
+		}
+	}
+
+	// Best first; newer messages win ties
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return kfs[hits[i].fpath].Entries[hits[i].entry].Timestamp > kfs[hits[j].fpath].Entries[hits[j].entry].Timestamp
+	})
+	if len(hits) > opts.MaxResults {
+		hits = hits[:opts.MaxResults]
+	}
+
+	// The index keeps previews only; reread each file with a hit once
+	// for the full text and any context
+	parsed := make(map[string][]Message)
+	var matches []Match
+	for _, h := range hits {
+		kf := kfs[h.fpath]
+		entry := kf.Entries[h.entry]
+		m := Match{Message: entry.message(), Score: h.score}
+		m.Message.Title = kf.Title
+		m.Message.Conversation = conversations[h.fpath]
+
+		msgs, ok := parsed[h.fpath]
+		if !ok {
+			msgs, _ = parseJSONLFile(h.fpath)
+			parsed[h.fpath] = msgs
+		}
+		if i := findEntryMessage(msgs, entry); i >= 0 {
+			m.Message.Text = msgs[i].Text
+			if opts.Before > 0 || opts.After > 0 {
+				t := newThread(msgs)
+				m.ContextBefore = t.before(i, opts.Before)
+				m.ContextAfter = t.after(i, opts.After)
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches, stats, nil
+}
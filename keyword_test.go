@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeywordSearch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	sessions := map[string]string{
+		"aaaa": `{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"the payment webhook test is flaky again"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-02T10:01:00Z","message":{"content":[{"type":"text","text":"Retrying the webhook fixed it."}]}}
+`,
+		"bbbb": `{"type":"user","uuid":"u1","timestamp":"2025-01-03T10:00:00Z","message":{"content":"write the payment docs"}}
+{"type":"user","uuid":"u2","parentUuid":"u1","timestamp":"2025-01-03T10:02:00Z","message":{"content":"nothing relevant here"}}
+`,
+	}
+	var files []string
+	for name, data := range sessions {
+		fp := filepath.Join(dir, name+".jsonl")
+		os.WriteFile(fp, []byte(data), 0644)
+		files = append(files, fp)
+	}
+
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+	check := func(label string) {
+		t.Helper()
+		matches, stats, err := keywordSearch("flaky payment webhook tests", dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.FilesTotal != 2 {
+			t.Errorf("%s: searched %d files, want 2", label, stats.FilesTotal)
+		}
+		// Every message with a query word, the one with all of them and
+		// their pairs first
+		if len(matches) != 3 {
+			t.Fatalf("%s: got %d matches, want 3: %+v", label, len(matches), matches)
+		}
+		if top := matches[0].Message.Text; top != "the payment webhook test is flaky again" {
+			t.Errorf("%s: top match %q", label, top)
+		}
+		for i, m := range matches {
+			if m.Score <= 0 || (i > 0 && m.Score > matches[i-1].Score) {
+				t.Errorf("%s [%d]: score %v out of order", label, i, m.Score)
+			}
+		}
+	}
+
+	// Unindexed files are tokenized on the fly; indexed ones come from
+	// the index, with the same ranking
+	check("unindexed")
+	if n, _, err := updateKeywordIndex("proj", files, false); err != nil || n != 2 {
+		t.Fatalf("indexed %d files, err %v", n, err)
+	}
+	check("indexed")
+
+	// Filters apply before ranking
+	opts.Role = "assistant"
+	matches, _, _ := keywordSearch("payment webhook", dir, opts)
+	if len(matches) != 1 || matches[0].Message.UUID != "a1" {
+		t.Errorf("-r: got %+v", matches)
+	}
+
+	if _, _, err := keywordSearch("the of a", dir, opts); err == nil {
+		t.Error("a query of stop words should be an error")
+	}
+}
+
+func TestBuildKeywordFile(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"summary","summary":"Deploy fixes","leafUuid":"u1"}
+{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"deploy deploys deployed"}}
+{"type":"user","uuid":"u2","timestamp":"2025-01-02T10:01:00Z","message":{"content":"the"}}
+`), 0644)
+	info, _ := os.Stat(fp)
+	kf, err := buildKeywordFile(fp, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kf.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1 (stop words only are left out)", len(kf.Entries))
+	}
+	if kf.Title != "Deploy fixes" {
+		t.Errorf("title %q", kf.Title)
+	}
+	// Stemming folds the three forms into one token
+	if p := kf.Postings["deploy"]; len(p) != 1 || p[0].Freq != 3 {
+		t.Errorf("deploy postings: %+v", p)
+	}
+	if p := kf.Postings["deploy_deploy"]; len(p) != 1 || p[0].Freq != 2 {
+		t.Errorf("bigram postings: %+v", p)
+	}
+	if kf.Lengths[0] != 5 {
+		t.Errorf("length %d, want 3 unigrams + 2 bigrams", kf.Lengths[0])
+	}
+}
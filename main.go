@@ -3,9 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -19,15 +20,44 @@ func main() {
 	// Flags
 	prompts := flag.Bool("p", false, "search only user prompts")
 	responses := flag.Bool("r", false, "search only assistant responses")
+	toolResults := flag.Bool("t", false, "search only tool results (command output, errors)")
 	allProjects := flag.Bool("a", false, "search all projects")
 	listOnly := flag.Bool("l", false, "list matching sessions only")
 	maxResults := flag.Int("n", 100, "max results")
 	maxDays := flag.Int("d", 7, "max age in days")
 	maxHours := flag.Int("H", 0, "max age in hours (overrides -d)")
+	sinceFlag := flag.String("since", "", "only messages at or after DATE (overrides -d/-H)")
+	untilFlag := flag.String("until", "", "only messages before DATE")
 	ctxBoth := flag.Int("C", 0, "context lines before and after")
 	ctxBefore := flag.Int("B", 0, "context lines before")
 	ctxAfter := flag.Int("A", 0, "context lines after")
 	semantic := flag.Bool("s", false, "semantic search mode")
+	keyword := flag.Bool("k", false, "rank messages by keywords (BM25)")
+	flag.BoolVar(keyword, "keyword", false, "rank messages by keywords (BM25)")
+	hybrid := flag.Bool("hybrid", false, "rank by keywords and meaning together")
+	hybridWeight := flag.Float64("hybrid-weight", 0.5, "share of the semantic ranking in --hybrid (0 to 1)")
+	fixed := flag.Bool("F", false, "treat the pattern as a literal string")
+	word := flag.Bool("w", false, "match whole words only")
+	smartCase := flag.Bool("S", false, "smart case: case-sensitive if the pattern has uppercase")
+	caseSens := flag.Bool("case-sensitive", false, "case-sensitive matching")
+	var ePatterns patternList
+	flag.Var(&ePatterns, "e", "search for PATTERN (repeatable)")
+	patternFile := flag.String("f", "", "read patterns from FILE, one per line")
+	without := flag.String("without", "", "drop sessions where any message matches PATTERN")
+	invert := flag.Bool("L", false, "list sessions with no match")
+	tool := flag.String("tool", "", "search only tool calls for this tool (e.g. Bash)")
+	thinking := flag.Bool("thinking", false, "include assistant thinking blocks")
+	fileGlob := flag.String("file", "", "search only file tool calls on paths matching GLOB")
+	sidechain := flag.String("sidechain", "include", "subagent messages: include, exclude or only")
+	branch := flag.String("branch", "", "only messages recorded on a matching git branch (glob)")
+	cwdFilter := flag.String("cwd", "", "only messages whose working directory matches (glob or prefix)")
+	ccVersion := flag.String("cc-version", "", "only messages from a matching Claude Code version (glob)")
+	near := flag.Int("near", 0, "match the second pattern within N messages after the first")
+	session := flag.String("session", "", "search only the session with this ID (or unique ID prefix)")
+	model := flag.String("model", "", "only assistant messages from a matching model (glob or substring)")
+	followCont := flag.Bool("follow-continuations", false, "treat chains of resumed sessions as one conversation")
+	costBy := flag.String("by", "day", "group cost by day, project, session or model (with cost)")
+	pricesFile := flag.String("prices", "", "JSON price table for cost (default: ~/.claude/search-index/prices.json)")
 	jsonOut := flag.Bool("json", false, "JSON output")
 	index := flag.Bool("index", false, "index sessions for semantic search")
 	indexStatus := flag.Bool("status", false, "show index status (use with --index)")
@@ -41,24 +71,65 @@ func main() {
 Usage:
   claude-grep [flags] <pattern>     regex search (default)
   claude-grep -s [flags] <query>    semantic search
+  claude-grep -k [flags] <words>    keyword search, best matches first
+  claude-grep --hybrid [flags] <q>  keyword and semantic search, fused
+  claude-grep "a AND b NOT c"       sessions matching a boolean query
+  claude-grep "role:user project:api after:2026-09-01 text"
+                                    qualifiers: role: tool: file: branch: cwd:
+                                    model: project: after: before:
+                                    (-F searches the pattern as written)
   claude-grep --index [--all]       build/update search index
   claude-grep --index --status      show index stats
+  claude-grep files [flags] <glob>  sessions that read/edited a file
+  claude-grep cost [flags]          token usage and spend
   claude-grep --usage               show usage stats
 
 Flags:
   -p            search only user prompts
   -r            search only assistant responses
+  -t            search only tool results (command output, errors)
   -a            search all projects (default: current dir)
   -l            list matching sessions only
+  -L            list sessions in scope with no match
   -n N          max results (default: 100)
   -d N          max age in days (default: 7)
   -H N          max age in hours (overrides -d)
+  --since DATE  messages from DATE on: 2026-09-01, RFC3339, yesterday,
+                "last monday", "2 weeks ago" (local time; overrides -d/-H)
+  --until DATE  messages before DATE (same forms)
   -C N          context messages before and after
   -B N          context messages before
   -A N          context messages after
   -s            semantic search (requires index)
+  -k, --keyword rank messages by how well they match the words (BM25)
+  --hybrid      fuse keyword and semantic rankings (requires index)
+  --hybrid-weight W
+                semantic share of the --hybrid ranking, 0 to 1 (default: 0.5)
+  -F            pattern is a literal string, not a regex
+  -w            match whole words only
+  -S            smart case: case-sensitive if the pattern has uppercase
+  --case-sensitive
+                always match case (default: ignore case)
+  -e PAT        a pattern to search for; repeat for several (any may match)
+  -f FILE       read patterns from FILE, one per line (- for stdin)
+  --without PAT drop sessions where any message matches PAT
+  --tool NAME   search only tool calls for NAME (Bash, Edit, Grep, ...)
+  --thinking    include assistant thinking blocks
+  --file GLOB   search only Read/Edit/Write calls on matching paths
+  --sidechain M subagent (Task) messages: include, exclude, only (default: include)
+  --branch GLOB git branch the message was recorded on (e.g. feat/*)
+  --cwd GLOB    working directory (glob, trailing path, or prefix)
+  --cc-version GLOB
+                Claude Code version (e.g. "1.0.*")
+  --near N      second pattern within N messages after the first (two patterns)
+  --session ID  only this session (full ID or unique prefix, any project or age)
+  --model PAT   model that wrote the response (e.g. sonnet, "claude-opus-4*")
+  --follow-continuations
+                search whole chains of resumed sessions as one conversation
+  --by KEY      cost grouping: day, project, session, model (default: day)
+  --prices FILE cost price table (default: ~/.claude/search-index/prices.json)
   --json        JSON output
-  --index       build/update vector index
+  --index       build/update trigram, keyword and vector indexes
   --status      show index stats (with --index)
   --all         reindex everything (with --index)
   --usage       show usage stats (agent telemetry)
@@ -70,7 +141,24 @@ Examples:
   claude-grep -C 2 "error"            matches with 2 messages context
   claude-grep -a -d 30 "deploy"       all projects, last 30 days
   claude-grep -H 4 "bug"              last 4 hours only
+  claude-grep --since "last monday" --until yesterday "deploy"
+                                      a date range
   claude-grep -s "that migration fix" semantic search by meaning
+  claude-grep -k "flaky webhook test retry"  messages with most of the words
+  claude-grep --hybrid "parseInvoice rounding"  exact names and related ideas
+  claude-grep --tool Bash "migrate"   commands that ran a migration
+  claude-grep -t "panic: runtime"     errors seen in tool output
+  claude-grep -F -S "Foo.Bar("        a literal, case-sensitive identifier
+  claude-grep -f incidents.txt -a     every known incident keyword, one pass
+  claude-grep "deploy AND rollback NOT staging"  sessions with both, never staging
+  claude-grep --near 3 "panic" "fixed"  an error and the fix that followed
+  claude-grep "deploy" --without rollback  deploys never rolled back
+  claude-grep -L -a "test"            sessions that never ran tests
+  claude-grep --thinking "tradeoff"   include the reasoning behind answers
+  claude-grep files billing/invoice.go  sessions that touched invoice.go
+  claude-grep --branch feat/payments "refund"  discussed on a branch
+  claude-grep --model opus -r "cache"  answers written by an Opus model
+  claude-grep cost -a -d 30 --by model  spend per model this month
   claude-grep --json "test" | jq .    pipe JSON to jq
 
 Exit codes:
@@ -102,12 +190,38 @@ Exit codes:
 		}
 	}
 
+	var since, until time.Time
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{{"since", *sinceFlag, &since}, {"until", *untilFlag, &until}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := parseDate(d.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --%s: %s\n", d.name, err)
+			os.Exit(2)
+		}
+		*d.dst = t
+	}
+
+	switch *sidechain {
+	case "include", "exclude", "only":
+	default:
+		fmt.Fprintf(os.Stderr, "error: --sidechain must be include, exclude or only (got %q)\n", *sidechain)
+		os.Exit(2)
+	}
+
 	// Determine role filter
 	role := "both"
 	if *prompts {
 		role = "user"
 	} else if *responses {
 		role = "assistant"
+	} else if *toolResults {
+		role = "tool"
 	}
 
 	// Index mode
@@ -120,31 +234,143 @@ Exit codes:
 		return
 	}
 
-	// Pattern required for search
-	if flag.NArg() < 1 {
+	// Subcommand: "files GLOB" lists sessions whose tool calls touched a path
+	filesMode := flag.NArg() == 2 && flag.Arg(0) == "files"
+	if filesMode {
+		*fileGlob = flag.Arg(1)
+	}
+
+	// Subcommand: "cost" totals token usage instead of searching
+	costMode := flag.NArg() == 1 && flag.Arg(0) == "cost"
+	if costMode && !slices.Contains(costGroupings, *costBy) {
+		fmt.Fprintf(os.Stderr, "error: --by must be one of %s (got %q)\n", strings.Join(costGroupings, ", "), *costBy)
+		os.Exit(2)
+	}
+
+	// Patterns from -e and -f replace the pattern argument
+	patterns := []string(ePatterns)
+	if *patternFile != "" {
+		ps, err := readPatternFile(*patternFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		if len(ps) == 0 {
+			fmt.Fprintf(os.Stderr, "error: no patterns in %s\n", *patternFile)
+			os.Exit(2)
+		}
+		patterns = append(patterns, ps...)
+	}
+	multi := len(patterns) > 0
+	if (*keyword && *semantic) || (*hybrid && (*keyword || *semantic)) {
+		fmt.Fprintf(os.Stderr, "error: -k, -s and --hybrid are different rankings — pick one\n")
+		os.Exit(2)
+	}
+	if *hybridWeight < 0 || *hybridWeight > 1 {
+		fmt.Fprintf(os.Stderr, "error: --hybrid-weight must be between 0 and 1 (got %g)\n", *hybridWeight)
+		os.Exit(2)
+	}
+	ranked := *semantic || *keyword || *hybrid
+	if (*invert || *without != "") && (ranked || filesMode || costMode) {
+		fmt.Fprintf(os.Stderr, "error: -L and --without work with regex search only\n")
+		os.Exit(2)
+	}
+	if *invert && (*near > 0 || *without != "") {
+		fmt.Fprintf(os.Stderr, "error: -L lists sessions without a match; combine patterns instead: claude-grep -L \"a|b\"\n")
+		os.Exit(2)
+	}
+	if *followCont && (*semantic || *hybrid) {
+		fmt.Fprintf(os.Stderr, "error: --follow-continuations works with regex and keyword search only\n")
+		os.Exit(2)
+	}
+	if multi && (flag.NArg() > 0 || *near > 0 || ranked) {
+		fmt.Fprintf(os.Stderr, "error: -e and -f replace the pattern argument and work with regex search only\n")
+		os.Exit(2)
+	}
+
+	// Pattern required for search (optional with --file)
+	if flag.NArg() < 1 && *fileGlob == "" && !multi {
 		flag.Usage()
 		os.Exit(2)
 	}
 	pattern := flag.Arg(0)
+	if filesMode || costMode {
+		pattern = ""
+	}
+	if multi {
+		pattern = strings.Join(patterns, "|") // for hints and telemetry
+	}
 
-	// Reject suspicious patterns that match everything (flag-parsing mistakes)
-	if isSuspiciousPattern(pattern) {
-		fmt.Fprintf(os.Stderr, "pattern %q matches everything — did you mean a different search term?\n", pattern)
-		fmt.Fprintf(os.Stderr, "  use -- to separate flags from pattern: claude-grep -- %q\n", pattern)
+	// Field qualifiers (role:user project:api after:2026-09-01 ...) are
+	// split out of the query; the rest is the pattern. A fixed string
+	// (-F) is taken whole, as are -e and -f patterns.
+	origPattern := pattern
+	var quals queryQuals
+	if !*fixed && !multi {
+		pattern, quals = parseQuery(pattern)
+		for _, w := range quals.Ignored {
+			fmt.Fprintf(os.Stderr, "note: %q is not a valid qualifier, searching it as text\n", w)
+		}
+	}
+	if quals.Project != "" && *session == "" {
+		*allProjects = true // project: picks among all projects
+	}
+	// --near takes a second pattern; qualifiers go in the first
+	nearPattern := flag.Arg(1)
+	if *near > 0 {
+		if flag.NArg() != 2 || ranked || (!*fixed && (isBoolQuery(pattern) || isBoolQuery(nearPattern))) {
+			fmt.Fprintf(os.Stderr, "error: --near N takes two regex patterns: claude-grep --near 3 \"panic\" \"fixed\"\n")
+			os.Exit(2)
+		}
+		if _, q := parseQuery(nearPattern); len(q.Keys) > 0 && !*fixed {
+			fmt.Fprintf(os.Stderr, "error: put qualifiers (%s:) in the first --near pattern\n", q.Keys[0])
+			os.Exit(2)
+		}
+	}
+	if ranked && pattern == "" && len(quals.Keys) > 0 {
+		fmt.Fprintf(os.Stderr, "error: semantic and keyword search need query text besides qualifiers\n")
 		os.Exit(2)
 	}
 
-	origPattern := pattern
+	// Smart case (-S): an uppercase letter in the pattern, other than a
+	// boolean operator or regex escape, makes matching case-sensitive
+	caseSensitive := *caseSens
+	if *smartCase && !caseSensitive {
+		text := pattern + " " + nearPattern
+		if !*fixed && !multi && isBoolQuery(text) {
+			var words []string
+			for _, t := range boolTokens(text) {
+				if !t.op {
+					words = append(words, t.word)
+				}
+			}
+			text = strings.Join(words, " ")
+		}
+		caseSensitive = hasUpper(text, *fixed)
+	}
+
+	// Reject suspicious patterns that match everything (flag-parsing mistakes)
+	for _, p := range append([]string{pattern}, patterns...) {
+		if !*fixed && isSuspiciousPattern(p) {
+			fmt.Fprintf(os.Stderr, "pattern %q matches everything — did you mean a different search term?\n", p)
+			fmt.Fprintf(os.Stderr, "  use -- to separate flags from pattern: claude-grep -- %q\n", p)
+			os.Exit(2)
+		}
+	}
+
 	startTime := time.Now()
 
 	// Warn about short patterns that produce noisy results
 	lit := longestLiteral(pattern)
-	if !*semantic && len(lit) <= 3 && len(lit) > 0 {
+	if *fixed {
+		lit = pattern
+	}
+	if !ranked && len(lit) <= 3 && len(lit) > 0 {
 		fmt.Fprintf(os.Stderr, "warning: short pattern %q will match many false positives — consider: claude-grep -s %q\n", pattern, pattern)
 	}
 
 	// Warn about extra positional args (agents try grep-style "pattern path")
-	hasExtraArgs := flag.NArg() > 1
+	hasExtraArgs := flag.NArg() > 1 && !filesMode && *near == 0
 	if hasExtraArgs {
 		fmt.Fprintf(os.Stderr, "warning: extra arguments ignored: %s\n", strings.Join(flag.Args()[1:], " "))
 		fmt.Fprintf(os.Stderr, "  claude-grep searches ~/.claude/projects/ automatically\n")
@@ -153,15 +379,23 @@ Exit codes:
 	// NOTE: with reorderArgs(), flags after the pattern are handled correctly.
 	// Extra args only trigger for truly unknown positional args (e.g. file paths).
 
-	// Resolve search path
-	searchPath, err := resolveSearchPath(*allProjects)
+	// Resolve search path: a named session, the current project or all
+	searchPath, err := resolveSearchPath(*allProjects || *session != "")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(2)
 	}
+	if *session != "" {
+		searchPath, err = findSessionFile(searchPath, *session)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+	}
 
-	// Auto-escalate to all projects if current project has very few sessions
-	if !*allProjects {
+	// Auto-escalate to all projects if current project has very few sessions.
+	// Cost reports and named sessions stay in the scope asked for.
+	if !*allProjects && !costMode && *session == "" {
 		files, _ := findSessionFiles(searchPath, *maxDays)
 		if len(files) <= 5 {
 			allSearchPath, err := resolveSearchPath(true)
@@ -174,7 +408,9 @@ Exit codes:
 	}
 
 	scope := "project"
-	if *allProjects {
+	if *session != "" {
+		scope = "session"
+	} else if *allProjects {
 		scope = "all"
 	}
 
@@ -182,11 +418,39 @@ Exit codes:
 	var flagList []string
 	if *prompts { flagList = append(flagList, "-p") }
 	if *responses { flagList = append(flagList, "-r") }
+	if *toolResults { flagList = append(flagList, "-t") }
 	if *allProjects { flagList = append(flagList, "-a") }
 	if *listOnly { flagList = append(flagList, "-l") }
+	if *invert { flagList = append(flagList, "-L") }
+	if *without != "" { flagList = append(flagList, "--without") }
 	if *semantic { flagList = append(flagList, "-s") }
+	if *keyword { flagList = append(flagList, "-k") }
+	if *hybrid { flagList = append(flagList, "--hybrid") }
+	if *hybridWeight != 0.5 { flagList = append(flagList, "--hybrid-weight") }
+	if *fixed { flagList = append(flagList, "-F") }
+	if len(ePatterns) > 0 { flagList = append(flagList, "-e") }
+	if *patternFile != "" { flagList = append(flagList, "-f") }
+	if *word { flagList = append(flagList, "-w") }
+	if *smartCase { flagList = append(flagList, "-S") }
+	if *caseSens { flagList = append(flagList, "--case-sensitive") }
 	if *jsonOut { flagList = append(flagList, "--json") }
+	if *tool != "" { flagList = append(flagList, "--tool") }
+	if *thinking { flagList = append(flagList, "--thinking") }
+	if *fileGlob != "" && !filesMode { flagList = append(flagList, "--file") }
+	if *sidechain != "include" { flagList = append(flagList, "--sidechain") }
+	if *followCont { flagList = append(flagList, "--follow-continuations") }
+	if *branch != "" { flagList = append(flagList, "--branch") }
+	if *cwdFilter != "" { flagList = append(flagList, "--cwd") }
+	if *ccVersion != "" { flagList = append(flagList, "--cc-version") }
+	if *model != "" { flagList = append(flagList, "--model") }
+	if *session != "" { flagList = append(flagList, "--session") }
+	if *near > 0 { flagList = append(flagList, "--near") }
+	for _, k := range quals.Keys { flagList = append(flagList, k+":") }
+	if costMode && *costBy != "day" { flagList = append(flagList, "--by") }
+	if *pricesFile != "" { flagList = append(flagList, "--prices") }
 	if *maxHours > 0 { flagList = append(flagList, "-H") }
+	if *sinceFlag != "" { flagList = append(flagList, "--since") }
+	if *untilFlag != "" { flagList = append(flagList, "--until") }
 	if *maxDays != 7 { flagList = append(flagList, "-d") }
 	if *maxResults != 100 { flagList = append(flagList, "-n") }
 	if *ctxBefore > 0 || *ctxAfter > 0 || *ctxBoth > 0 {
@@ -200,11 +464,38 @@ Exit codes:
 		Before:      *ctxBefore,
 		After:       *ctxAfter,
 		ListOnly:    *listOnly,
-		ExcludeSelf: true,
+		ExcludeSelf: *session == "",
+		Tool:        *tool,
+		Thinking:    *thinking,
+		File:        *fileGlob,
+		Sidechain:   *sidechain,
+		Branch:      *branch,
+		Cwd:         *cwdFilter,
+		CCVersion:   *ccVersion,
+		Model:       *model,
+
+		Fixed:         *fixed,
+		Word:          *word,
+		CaseSensitive: caseSensitive,
+		Without:       *without,
+
+		FollowContinuations: *followCont,
 	}
 	if *maxHours > 0 {
 		opts.MaxAge = time.Duration(*maxHours) * time.Hour
 	}
+	opts.Since, opts.Until = since, until
+	if *session != "" && *maxDays == 7 && *maxHours == 0 {
+		opts.MaxDays = 0 // a named session is searched whole unless -d/-H say otherwise
+	}
+	quals.apply(&opts)
+	if msg := opts.conflict(); msg != "" {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		os.Exit(2)
+	}
+	windowSet := false
+	flag.Visit(func(f *flag.Flag) { windowSet = windowSet || f.Name == "d" || f.Name == "H" })
+	opts.resolveWindow(windowSet)
 
 	// Set search query for BM25 compression in terminal output.
 	// Extract literal words from regex pattern — regex metacharacters
@@ -213,7 +504,68 @@ Exit codes:
 	// "deploy.*config" → tokens "deploy", "config"
 	searchQuery = pattern
 
+	if filesMode {
+		sessions, stats, err := fileTimeline(*fileGlob, searchPath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		logUsage(UsageEvent{
+			Pattern: *fileGlob, Mode: "files", Flags: strings.Join(flagList, " "),
+			Results: len(sessions), Files: stats.FilesTotal, Days: *maxDays,
+			Scope: scope, DurationMs: time.Since(startTime).Milliseconds(),
+			PrefilterSkip: stats.PrefilterSkipped, RegexSearched: stats.RegexSearched,
+			IndexSkip: stats.IndexSkipped,
+		})
+		if len(sessions) == 0 {
+			fmt.Fprintf(os.Stderr, "no file operations on %q (%d files, %s)\n", *fileGlob, stats.FilesTotal, opts.describeWindow())
+			fmt.Fprintf(os.Stderr, "retry: claude-grep -a -d 30 files %q\n", *fileGlob)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatFileTimelineJSON(sessions, os.Stdout)
+		} else {
+			formatFileTimeline(sessions, *listOnly, os.Stdout)
+		}
+		return
+	}
+
+	if costMode {
+		prices, err := loadPrices(*pricesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: prices: %s\n", err)
+			os.Exit(2)
+		}
+		report, files, err := runCost(searchPath, opts, *costBy, prices)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		logUsage(UsageEvent{
+			Mode: "cost", Flags: strings.Join(flagList, " "),
+			Results: len(report.Rows), Files: files, Days: *maxDays,
+			Scope: scope, DurationMs: time.Since(startTime).Milliseconds(),
+		})
+		if len(report.Rows) == 0 {
+			fmt.Fprintf(os.Stderr, "no token usage since %s (%d files)\n", report.Since, files)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatCostJSON(report, os.Stdout)
+		} else {
+			formatCostTerminal(report, os.Stdout)
+		}
+		if len(report.Total.Unpriced) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: no price for %s — counted as $0, add to %s\n",
+				strings.Join(report.Total.Unpriced, ", "), pricesPath())
+		}
+		return
+	}
+
 	if *semantic {
+		if opts.Role == "tool" {
+			fmt.Fprintf(os.Stderr, "warning: tool results are not indexed — drop -s to regex search them\n")
+		}
 		matches, err := semanticSearch(pattern, searchPath, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %s\n", err)
@@ -242,12 +594,174 @@ Exit codes:
 		return
 	}
 
+	if *keyword || *hybrid {
+		mode := "keyword"
+		var matches []Match
+		var searchStats SearchStats
+		var err error
+		if *hybrid {
+			mode = "hybrid"
+			matches, searchStats, err = hybridSearch(pattern, searchPath, opts, *hybridWeight)
+		} else {
+			matches, searchStats, err = keywordSearch(pattern, searchPath, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		capped := len(matches) >= opts.MaxResults
+		logUsage(UsageEvent{
+			Pattern: pattern, Mode: mode, Flags: strings.Join(flagList, " "),
+			Results: len(matches), Files: searchStats.FilesTotal, Days: *maxDays,
+			Scope: scope, ExtraArgs: hasExtraArgs, Capped: capped,
+			DurationMs: time.Since(startTime).Milliseconds(),
+		})
+		if len(matches) == 0 {
+			printNoMatchHint(pattern, searchPath, opts, true, searchStats)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatJSON(matches, os.Stdout)
+		} else {
+			formatTerminal(matches, opts)
+		}
+		if capped {
+			printCapHint(opts)
+		}
+		return
+	}
+
 	// Normalize BRE syntax to ERE (agents write \| \( \) \+ \? instead of | ( ) + ?)
-	hasBRE := pattern != normalizeBRE(pattern)
-	pattern = normalizeBRE(pattern)
+	hasBRE := !*fixed && pattern != normalizeBRE(pattern)
+	if !*fixed {
+		pattern = normalizeBRE(pattern)
+		nearPattern = normalizeBRE(nearPattern)
+		for i, p := range patterns {
+			patterns[i] = normalizeBRE(p)
+		}
+		opts.Without = normalizeBRE(opts.Without)
+	}
+	if !multi {
+		patterns = []string{pattern}
+	}
+
+	// Proximity: the second pattern within N messages after the first
+	if *near > 0 {
+		searchQuery = pattern + " " + nearPattern
+		matches, searchStats, err := nearSearch(pattern, nearPattern, *near, searchPath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		capped := len(matches) >= opts.MaxResults
+		logUsage(UsageEvent{
+			Pattern: origPattern + " ~ " + flag.Arg(1), Mode: "near", Flags: strings.Join(flagList, " "),
+			Results: len(matches), Files: searchStats.FilesTotal, Days: *maxDays,
+			Scope: scope, BRE: hasBRE, Capped: capped,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			PrefilterSkip: searchStats.PrefilterSkipped,
+			RegexSearched: searchStats.RegexSearched,
+			IndexSkip:     searchStats.IndexSkipped,
+		})
+		if len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "no %q within %d messages after %q (%d files, %s)\n", nearPattern, *near, pattern, searchStats.FilesTotal, opts.describeWindow())
+			fmt.Fprintf(os.Stderr, "retry: claude-grep -a -d 30 --near %d %q %q\n", *near*2, pattern, nearPattern)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatJSON(matches, os.Stdout)
+		} else {
+			formatTerminal(matches, opts)
+		}
+		if capped {
+			printCapHint(opts)
+		}
+		return
+	}
+
+	// -L: sessions in scope where nothing matches
+	if *invert {
+		if !*fixed && !multi && isBoolQuery(pattern) {
+			fmt.Fprintf(os.Stderr, "error: -L takes a regex; for sessions without a term use \"a AND b NOT c\"\n")
+			os.Exit(2)
+		}
+		sessions, searchStats, err := invertSearch(patterns, searchPath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		capped := len(sessions) >= opts.MaxResults
+		logUsage(UsageEvent{
+			Pattern: origPattern, Mode: "invert", Flags: strings.Join(flagList, " "),
+			Results: len(sessions), Files: searchStats.FilesTotal, Days: *maxDays,
+			Scope: scope, BRE: hasBRE, Capped: capped,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			PrefilterSkip: searchStats.PrefilterSkipped,
+			RegexSearched: searchStats.RegexSearched,
+			IndexSkip:     searchStats.IndexSkipped,
+		})
+		if len(sessions) == 0 {
+			fmt.Fprintf(os.Stderr, "every session matches %q (%d files, %s)\n", pattern, searchStats.FilesTotal, opts.describeWindow())
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatSessionsJSON(sessions, os.Stdout)
+		} else {
+			opts.ListOnly = true
+			formatTerminal(sessions, opts)
+		}
+		if capped {
+			fmt.Fprintf(os.Stderr, "sessions capped at %d — use -n for more\n", opts.MaxResults)
+		}
+		return
+	}
 
-	// Regex search
-	matches, searchStats, err := regexSearch(pattern, searchPath, opts)
+	// Boolean queries ("a AND b NOT c") are evaluated per session
+	if !*fixed && !multi && isBoolQuery(pattern) {
+		q, err := parseBoolQuery(pattern, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s — -F searches the pattern as written\n", err)
+			os.Exit(2)
+		}
+		searchQuery = strings.Join(q.terms(), " ")
+		matches, searchStats, err := boolSearch(q, searchPath, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(2)
+		}
+		sessions := make(map[string]bool)
+		for _, m := range matches {
+			sessions[m.Message.FilePath] = true
+		}
+		capped := len(sessions) >= opts.MaxResults
+		logUsage(UsageEvent{
+			Pattern: origPattern, Mode: "boolean", Flags: strings.Join(flagList, " "),
+			Results: len(matches), Files: searchStats.FilesTotal, Days: *maxDays,
+			Scope: scope, BRE: hasBRE, ExtraArgs: hasExtraArgs, Capped: capped,
+			DurationMs: time.Since(startTime).Milliseconds(),
+			PrefilterSkip: searchStats.PrefilterSkipped,
+			RegexSearched: searchStats.RegexSearched,
+			IndexSkip:     searchStats.IndexSkipped,
+		})
+		if len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "no session matches %q (%d files, %s)\n", pattern, searchStats.FilesTotal, opts.describeWindow())
+			fmt.Fprintf(os.Stderr, "hint: each AND term must appear in the same session; OR widens a term\n")
+			fmt.Fprintf(os.Stderr, "retry: claude-grep -a -d 30 %q\n", pattern)
+			os.Exit(1)
+		}
+		if *jsonOut {
+			formatJSON(matches, os.Stdout)
+		} else {
+			formatTerminal(matches, opts)
+		}
+		if capped {
+			fmt.Fprintf(os.Stderr, "sessions capped at %d — narrow the query or use -n\n", opts.MaxResults)
+		}
+		return
+	}
+
+	// Regex search: the pattern, or every -e/-f pattern in one pass
+	matches, searchStats, err := multiSearch(patterns, searchPath, opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(2)
@@ -261,13 +775,17 @@ Exit codes:
 		DurationMs: time.Since(startTime).Milliseconds(),
 		PrefilterSkip: searchStats.PrefilterSkipped,
 		RegexSearched: searchStats.RegexSearched,
+		IndexSkip:     searchStats.IndexSkipped,
 	})
 
 	if len(matches) == 0 {
-		// Auto-fallback: try semantic search when regex finds nothing
-		if !*semantic && ollamaReachable() {
+		// Auto-fallback: try semantic search when regex finds nothing.
+		// It can't honor --without, so sessions excluded there would
+		// come back, and with no vector index there's nothing to try.
+		// Qualifiers are already filters in opts; only the text is embedded
+		if !*semantic && !multi && !*followCont && opts.Without == "" && pattern != "" && hasVectorIndex() && embedderReady() {
 			fmt.Fprintf(os.Stderr, "no regex matches — trying semantic search...\n")
-			semMatches, semErr := semanticSearch(origPattern, searchPath, opts)
+			semMatches, semErr := semanticSearch(pattern, searchPath, opts)
 			if semErr == nil && len(semMatches) > 0 {
 				logUsage(UsageEvent{
 					Pattern: origPattern, Mode: "semantic-fallback", Flags: strings.Join(flagList, " "),
@@ -300,6 +818,39 @@ Exit codes:
 	}
 }
 
+// patternList collects the values of a repeated flag (-e).
+type patternList []string
+
+func (p *patternList) String() string { return strings.Join(*p, ", ") }
+
+func (p *patternList) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// readPatternFile reads the patterns of -f, one per line, skipping blank
+// lines. "-" reads stdin.
+func readPatternFile(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
 // reorderArgs moves flags after the pattern to before it.
 // Go's flag.Parse() stops at the first non-flag arg, so
 // "claude-grep pattern -n 5" fails. This reorders to "-n 5 pattern".
@@ -312,6 +863,14 @@ func reorderArgs() {
 	// Flags that consume the next arg as a value
 	valueTakers := map[string]bool{
 		"-n": true, "-d": true, "-H": true, "-C": true, "-B": true, "-A": true,
+		"-tool": true, "--tool": true, "-file": true, "--file": true,
+		"-sidechain": true, "--sidechain": true, "-branch": true, "--branch": true,
+		"-cwd": true, "--cwd": true, "-cc-version": true, "--cc-version": true,
+		"-model": true, "--model": true, "-near": true, "--near": true, "-session": true, "--session": true,
+		"-by": true, "--by": true, "-prices": true, "--prices": true,
+		"-e": true, "--e": true, "-f": true, "--f": true, "-without": true, "--without": true,
+		"-since": true, "--since": true, "-until": true, "--until": true,
+		"-hybrid-weight": true, "--hybrid-weight": true,
 	}
 
 	var flags, positional []string
@@ -365,11 +924,17 @@ func resolveSearchPath(allProjects bool) (string, error) {
 
 func printNoMatchHint(pattern, searchPath string, opts SearchOpts, isSemantic bool, stats SearchStats) {
 	scope := "current project"
-	if strings.HasSuffix(searchPath, filepath.Join(".claude", "projects")) {
+	if isSessionFile(searchPath) {
+		scope = "session " + shortID(extractSessionID(searchPath))
+	} else if strings.HasSuffix(searchPath, filepath.Join(".claude", "projects")) {
 		scope = "all projects"
 	}
 
-	fmt.Fprintf(os.Stderr, "no matches for %q (%d files, %d days, %s)\n", pattern, stats.FilesTotal, opts.MaxDays, scope)
+	fmt.Fprintf(os.Stderr, "no matches for %q (%d files, %s, %s)\n", pattern, stats.FilesTotal, opts.describeWindow(), scope)
+
+	if opts.Without != "" {
+		fmt.Fprintf(os.Stderr, "note: sessions mentioning %q were dropped (--without)\n", opts.Without)
+	}
 
 	// If prefilter killed everything and pattern has spaces, explain why
 	if !isSemantic && strings.Contains(pattern, " ") && stats.PrefilterSkipped == stats.FilesTotal && stats.FilesTotal > 0 {
@@ -382,11 +947,14 @@ func printNoMatchHint(pattern, searchPath string, opts SearchOpts, isSemantic bo
 		if len(words) >= 2 {
 			fmt.Fprintf(os.Stderr, "hint: try: \"(%s)\" or \"%s\"\n",
 				strings.Join(words, "|"), strings.Join(words, ".*"))
+			fmt.Fprintf(os.Stderr, "or:    claude-grep -k %q  (ranked by how many words match)\n", pattern)
 		}
 	}
 
 	// Copy-pasteable retry command
-	if scope == "current project" || opts.MaxDays <= 7 {
+	if !opts.Since.IsZero() || !opts.Until.IsZero() {
+		fmt.Fprintf(os.Stderr, "hint: only messages %s were searched — widen --since/--until\n", opts.describeWindow())
+	} else if !isSessionFile(searchPath) && (scope == "current project" || opts.MaxDays <= 7) {
 		fmt.Fprintf(os.Stderr, "retry: claude-grep -a -d 30 %q\n", pattern)
 	}
 	if !isSemantic {
@@ -399,18 +967,19 @@ func printNoMatchHint(pattern, searchPath string, opts SearchOpts, isSemantic bo
 // case-insensitive substring search to show near-misses.
 func printNearMiss(pattern, searchPath string, opts SearchOpts) {
 	lit := longestLiteral(pattern)
-	if len(lit) < 3 || lit == strings.TrimLeft(pattern, "(?i:") {
+	if opts.Fixed {
+		lit = pattern
+	}
+	// A case-sensitive or whole-word search is worth relaxing even when
+	// the pattern is a plain literal
+	relaxed := opts.CaseSensitive || opts.Word
+	if len(lit) < 3 || (!relaxed && lit == strings.TrimLeft(pattern, "(?i:")) {
 		// Pattern IS a simple literal, or too short — no point retrying
 		return
 	}
 
-	// Quick search using the literal as the pattern
-	relaxedOpts := opts
-	relaxedOpts.MaxResults = 3
-	re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(lit))
-	if err != nil {
-		return
-	}
+	// Quick search using the literal as a case-insensitive substring
+	literals := [][]byte{[]byte(strings.ToLower(lit))}
 	files, err := findSessionFiles(searchPath, opts.MaxDays)
 	if err != nil || len(files) == 0 {
 		return
@@ -418,11 +987,13 @@ func printNearMiss(pattern, searchPath string, opts SearchOpts) {
 
 	var found int
 	for _, f := range files {
-		data, err := os.ReadFile(f)
+		fh, err := os.Open(f)
 		if err != nil {
 			continue
 		}
-		if re.Match(data) {
+		ok, _ := prefilterReader(fh, literals)
+		fh.Close()
+		if ok {
 			found++
 		}
 		if found >= 3 {
@@ -445,7 +1016,7 @@ func isSuspiciousPattern(pattern string) bool {
 
 func printCapHint(opts SearchOpts) {
 	hint := fmt.Sprintf("results capped at %d — narrow your pattern or use -n 100", opts.MaxResults)
-	if opts.MaxDays <= 7 {
+	if opts.MaxDays > 0 && opts.MaxDays <= 7 && opts.Since.IsZero() {
 		hint += ", -d 30"
 	}
 	fmt.Fprintln(os.Stderr, hint)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+)
+
+// nearSearch finds places where pattern b matches within n messages after
+// a match of pattern a in the same session — an error and the fix that
+// resolved it. Each result is the a-message with the messages up to the
+// b-message as its after-context and the b-message as Partner. Distance
+// counts only messages that pass the filters.
+func nearSearch(a, b string, n int, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
+	reA, err := opts.compile(a)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+	reB, err := opts.compile(b)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+
+	without, err := opts.withoutRe()
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+
+	files, conversations, err := searchScope(searchPath, opts)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+
+	// Both patterns must occur in a file for it to be parsed. Folded
+	// and exact literals can't share one pass, so fold both if either
+	// needs it.
+	exact := opts.exactCase(a) && opts.exactCase(b)
+	var groups [][][]byte
+	for _, p := range []string{a, b} {
+		o := opts
+		o.CaseSensitive = exact
+		if lits := o.prefilterLiterals(p); lits != nil {
+			groups = append(groups, lits)
+		}
+	}
+
+	candidates, ruledOut := trigramFilter(files, groups)
+	results, pfSkipped := searchEach(candidates, func(fp string) ([]Match, bool) {
+		messages, skipped := readSession(fp, groups, exact)
+		if mentions(messages, without) {
+			return nil, skipped
+		}
+		return nearMatches(messages, reA, reB, n, opts), skipped
+	})
+
+	var allMatches []Match
+	for _, r := range results {
+		allMatches = append(allMatches, r...)
+	}
+	for i := range allMatches {
+		allMatches[i].Message.Conversation = conversations[allMatches[i].Message.FilePath]
+	}
+	sort.Slice(allMatches, func(i, j int) bool {
+		return allMatches[i].Message.Timestamp > allMatches[j].Message.Timestamp
+	})
+	if len(allMatches) > opts.MaxResults {
+		allMatches = allMatches[:opts.MaxResults]
+	}
+
+	return allMatches, newSearchStats(len(files), len(ruledOut), pfSkipped), nil
+}
+
+// nearMatches pairs each b-match in one session with the closest
+// preceding a-match at most n filtered messages before it. An a-match
+// pairs once, so "panic, panic, fixed" yields one span from the second
+// panic.
+func nearMatches(messages []Message, reA, reB *regexp.Regexp, n int, opts SearchOpts) []Match {
+	var accepted []int // indexes into messages of those passing the filters
+	for i, msg := range messages {
+		if opts.accepts(msg) {
+			accepted = append(accepted, i)
+		}
+	}
+
+	var matches []Match
+	var t *thread
+	last := -1 // position in accepted of the latest unpaired a-match
+	for pos, i := range accepted {
+		text := messages[i].Text
+		if last >= 0 && pos-last <= n && reB.MatchString(text) {
+			start := accepted[last]
+			m := Match{Message: messages[start], Partner: &messages[i]}
+			for _, j := range accepted[last+1 : pos] {
+				m.ContextAfter = append(m.ContextAfter, messages[j])
+			}
+			if opts.Before > 0 {
+				if t == nil {
+					t = newThread(messages)
+				}
+				m.ContextBefore = t.before(start, opts.Before)
+			}
+			matches = append(matches, m)
+			last = -1
+			continue
+		}
+		if reA.MatchString(text) {
+			last = pos
+		}
+	}
+	return matches
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestNearMatches(t *testing.T) {
+	texts := []string{
+		"panic: nil map",            // 0
+		"looking into it",           // 1
+		"panic: nil map again",      // 2
+		"tried a guard",             // 3
+		"fixed by initializing",     // 4
+		"unrelated",                 // 5
+		"panic: index out of range", // 6
+		"a",                         // 7
+		"b",                         // 8
+		"c",                         // 9
+		"fixed much later",          // 10
+	}
+	var msgs []Message
+	for i, text := range texts {
+		msgs = append(msgs, Message{Type: "user", Kind: "text", Text: text, MsgIndex: i, Parent: i - 1})
+	}
+	reA := regexp.MustCompile("(?i)panic")
+	reB := regexp.MustCompile("(?i)fixed")
+	opts := SearchOpts{Role: "both"}
+
+	got := nearMatches(msgs, reA, reB, 3, opts)
+	if len(got) != 1 {
+		t.Fatalf("got %d spans, want 1: %+v", len(got), got)
+	}
+	m := got[0]
+	if m.Message.MsgIndex != 2 || m.Partner == nil || m.Partner.MsgIndex != 4 {
+		t.Errorf("span should run from the closest panic (2) to the fix (4): %+v", m)
+	}
+	if len(m.ContextAfter) != 1 || m.ContextAfter[0].MsgIndex != 3 {
+		t.Errorf("span context: %+v", m.ContextAfter)
+	}
+
+	// A wider window also catches the late fix
+	if got := nearMatches(msgs, reA, reB, 4, opts); len(got) != 2 {
+		t.Errorf("--near 4: got %d spans, want 2", len(got))
+	}
+
+	// Distance counts only messages that pass the filters
+	for i := 7; i <= 9; i++ {
+		msgs[i].Kind = "tool_result"
+	}
+	if got := nearMatches(msgs, reA, reB, 1, opts); len(got) != 1 || got[0].Message.MsgIndex != 6 {
+		t.Errorf("filtered messages should not count toward distance: %+v", got)
+	}
+}
+
+func TestNearSearchToolOutput(t *testing.T) {
+	// The README example: --near 5 -t "FAIL" "ok\s", with the session
+	// in the trigram index
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	fp := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"assistant","timestamp":"2025-01-01T12:00:00Z","message":{"content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./..."}}]}}
+{"type":"user","timestamp":"2025-01-01T12:00:01Z","message":{"content":[{"type":"tool_result","tool_use_id":"t1","content":"--- FAIL: TestRound\nFAIL\tgithub.com/x/billing"}]}}
+{"type":"assistant","timestamp":"2025-01-01T12:00:02Z","message":{"content":[{"type":"tool_use","id":"t2","name":"Bash","input":{"command":"go test ./..."}}]}}
+{"type":"user","timestamp":"2025-01-01T12:00:03Z","message":{"content":[{"type":"tool_result","tool_use_id":"t2","content":"ok  \tgithub.com/x/billing\t0.4s"}]}}
+`), 0644)
+	updateTrigramIndex("proj", []string{fp}, false)
+
+	opts := SearchOpts{Role: "tool", MaxDays: 3650, MaxResults: 10}
+	matches, _, err := nearSearch("FAIL", `ok\s`, 5, dir, opts)
+	if err != nil || len(matches) != 1 || matches[0].Partner == nil {
+		t.Fatalf("got %+v, err %v", matches, err)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryQuals holds the field qualifiers of a query string, such as
+// `role:user project:*api* after:2026-09-01 "migration failed"`.
+// They put every constraint into the one argument agents compose, instead
+// of a flag combination they have to guess.
+type queryQuals struct {
+	Role    string // "user", "assistant", "tool" or "both"
+	Tool    string
+	File    string
+	Branch  string
+	Cwd     string
+	Model   string
+	Project string
+	Since   time.Time
+	Until   time.Time
+	Keys    []string // qualifiers used, for telemetry
+	Ignored []string // key:value words with an invalid value, left in the pattern
+}
+
+// queryKeys are the recognized qualifiers. Anything else with a colon
+// (URLs, "error:", Go's "(?i:") stays part of the pattern.
+var queryKeys = []string{"role", "tool", "file", "branch", "cwd", "model", "project", "after", "before"}
+
+// parseQuery splits field qualifiers out of a query and returns the
+// remaining pattern. Only a whole word of the form key:value with a valid
+// value is a qualifier; double quotes group a value's words
+// (`branch:"feat/x y"`). The rest of the query is kept byte for byte,
+// except that a pattern left as one quoted phrase (`"migration failed"`)
+// loses its quotes. Qualifier-like words whose value isn't valid, such as
+// `role:\s*user`, stay in the pattern and are listed in Ignored.
+func parseQuery(query string) (string, queryQuals) {
+	var q queryQuals
+	var cut [][2]int // byte spans of the qualifiers
+	for _, sp := range querySpans(query) {
+		tok := query[sp[0]:sp[1]]
+		key, value, ok := strings.Cut(tok, ":")
+		if !ok || !slices.Contains(queryKeys, key) || value == "" {
+			continue
+		}
+		if !q.set(key, unquote(value)) {
+			q.Ignored = append(q.Ignored, tok)
+			continue
+		}
+		q.Keys = append(q.Keys, key)
+		cut = append(cut, sp)
+	}
+	if len(cut) == 0 {
+		return query, q // a plain pattern, untouched
+	}
+
+	// Drop each qualifier with the space before it, or after it when
+	// nothing precedes it, so the words around it keep their spacing
+	var b strings.Builder
+	last := 0
+	for _, sp := range cut {
+		start, end := sp[0], sp[1]
+		if strings.TrimSpace(b.String()+query[last:start]) != "" {
+			for start > last && isQuerySpace(query[start-1]) {
+				start--
+			}
+		} else {
+			for end < len(query) && isQuerySpace(query[end]) {
+				end++
+			}
+		}
+		b.WriteString(query[last:start])
+		last = end
+	}
+	b.WriteString(query[last:])
+	rest := b.String()
+	if len(rest) >= 2 && strings.Count(rest, `"`) == 2 && rest[0] == '"' && rest[len(rest)-1] == '"' {
+		rest = rest[1 : len(rest)-1]
+	}
+	return rest, q
+}
+
+// set records a qualifier and reports whether its value is valid: a role,
+// a date, or a name or glob without regex syntax.
+func (q *queryQuals) set(key, value string) bool {
+	switch key {
+	case "role":
+		role, err := parseRole(value)
+		if err != nil {
+			return false
+		}
+		q.Role = role
+		return true
+	case "after", "before":
+		t, err := parseDate(value)
+		if err != nil {
+			return false
+		}
+		if key == "after" {
+			q.Since = t
+		} else {
+			q.Until = t
+		}
+		return true
+	}
+	if value == "" || strings.ContainsAny(value, `\()|^$+{}`) {
+		return false
+	}
+	switch key {
+	case "tool":
+		q.Tool = value
+	case "file":
+		q.File = value
+	case "branch":
+		q.Branch = value
+	case "cwd":
+		q.Cwd = value
+	case "model":
+		q.Model = value
+	case "project":
+		q.Project = value
+	}
+	return true
+}
+
+// querySpans returns the byte spans of a query's words, split on spaces
+// and tabs outside double quotes.
+func querySpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			quoted = !quoted
+		}
+		if isQuerySpace(s[i]) && !quoted {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+func isQuerySpace(c byte) bool { return c == ' ' || c == '\t' }
+
+// unquote removes one pair of surrounding double quotes.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func parseRole(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "user", "prompt", "you":
+		return "user", nil
+	case "assistant", "ai", "response":
+		return "assistant", nil
+	case "tool", "output":
+		return "tool", nil
+	case "both", "any":
+		return "both", nil
+	}
+	return "", fmt.Errorf("role must be user, assistant, tool or both (got %q)", s)
+}
+
+// dateLayouts are the absolute date forms accepted by parseDate, in
+// local time unless they carry a zone.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	time.RFC3339,
+}
+
+// parseDate parses an absolute date or time, or a phrase relative to now:
+// "today", "yesterday", "monday" or "last monday" (the latest Monday
+// before today), "3 days ago", "2 weeks ago", "an hour ago", "last
+// week". Named days start at local midnight; "ago" counts back from now.
+func parseDate(s string) (time.Time, error) {
+	return parseDateAt(s, time.Now())
+}
+
+func parseDateAt(s string, now time.Time) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	phrase := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch phrase {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	case "last week":
+		return now.AddDate(0, 0, -7), nil
+	case "last month":
+		return now.AddDate(0, -1, 0), nil
+	case "last year":
+		return now.AddDate(-1, 0, 0), nil
+	}
+	if wd, ok := weekdays[strings.TrimPrefix(phrase, "last ")]; ok {
+		days := (int(now.Weekday()) - int(wd) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return midnight.AddDate(0, 0, -days), nil
+	}
+	if t, ok := parseAgo(phrase, now); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf(`unrecognized date %q (use YYYY-MM-DD, "yesterday", "last monday" or "2 weeks ago")`, s)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseAgo parses "N unit(s) ago", where N may be "a" or "an".
+func parseAgo(phrase string, now time.Time) (time.Time, bool) {
+	f := strings.Fields(phrase)
+	if len(f) != 3 || f[2] != "ago" {
+		return time.Time{}, false
+	}
+	n := 1
+	if f[0] != "a" && f[0] != "an" {
+		var err error
+		if n, err = strconv.Atoi(f[0]); err != nil || n < 0 {
+			return time.Time{}, false
+		}
+	}
+	switch strings.TrimSuffix(f[1], "s") {
+	case "minute", "min":
+		return now.Add(-time.Duration(n) * time.Minute), true
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "day":
+		return now.AddDate(0, 0, -n), true
+	case "week":
+		return now.AddDate(0, 0, -7*n), true
+	case "month":
+		return now.AddDate(0, -n, 0), true
+	case "year":
+		return now.AddDate(-n, 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+// apply copies the qualifiers onto search options; qualifiers win over
+// the equivalent flags.
+func (q queryQuals) apply(opts *SearchOpts) {
+	if q.Role != "" {
+		opts.Role = q.Role
+	}
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&opts.Tool, q.Tool)
+	set(&opts.File, q.File)
+	set(&opts.Branch, q.Branch)
+	set(&opts.Cwd, q.Cwd)
+	set(&opts.Model, q.Model)
+	set(&opts.Project, q.Project)
+	if !q.Since.IsZero() {
+		opts.Since = q.Since
+	}
+	if !q.Until.IsZero() {
+		opts.Until = q.Until
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		pattern string
+		check   func(q queryQuals) bool
+	}{
+		{
+			query:   `role:assistant tool:Bash project:*api* after:2026-09-01 "migration failed"`,
+			pattern: "migration failed",
+			check: func(q queryQuals) bool {
+				return q.Role == "assistant" && q.Tool == "Bash" && q.Project == "*api*" &&
+					q.Since.Equal(time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)) &&
+					strings.Join(q.Keys, ",") == "role,tool,project,after"
+			},
+		},
+		{
+			query:   `branch:"feat/x y" refund`,
+			pattern: "refund",
+			check:   func(q queryQuals) bool { return q.Branch == "feat/x y" },
+		},
+		{
+			query:   "role:ai before:2026-01-02T15:04 deploy AND rollback",
+			pattern: "deploy AND rollback",
+			check: func(q queryQuals) bool {
+				return q.Role == "assistant" && q.Until.Equal(time.Date(2026, 1, 2, 15, 4, 0, 0, time.Local))
+			},
+		},
+		// Unknown keys, URLs and regex groups are left alone
+		{query: `(?i:error:  timeout)`, pattern: `(?i:error:  timeout)`, check: func(q queryQuals) bool { return len(q.Keys) == 0 }},
+		{query: "see https://example.com tool:Read", pattern: "see https://example.com", check: func(q queryQuals) bool { return q.Tool == "Read" }},
+		{query: "tool: Bash", pattern: "tool: Bash", check: func(q queryQuals) bool { return q.Tool == "" }},
+		{query: "model:opus", pattern: "", check: func(q queryQuals) bool { return q.Model == "opus" }},
+		// A key with an invalid value is pattern text, not a qualifier
+		{query: `role:\s*user`, pattern: `role:\s*user`, check: func(q queryQuals) bool { return q.Role == "" && len(q.Ignored) == 1 }},
+		{query: "role:robot x", pattern: "role:robot x", check: func(q queryQuals) bool { return len(q.Keys) == 0 }},
+		{query: "after:yesterdayish x", pattern: "after:yesterdayish x", check: func(q queryQuals) bool { return q.Since.IsZero() }},
+		{query: `tool:Bash file:(foo|bar)\.go`, pattern: `file:(foo|bar)\.go`, check: func(q queryQuals) bool { return q.Tool == "Bash" && q.File == "" }},
+		// The rest of the pattern keeps its quotes and spacing
+		{query: `role:user  a  "b"   c`, pattern: `a  "b"   c`, check: func(q queryQuals) bool { return q.Role == "user" }},
+		{query: "say \"hi\" tool:Bash\tnow", pattern: "say \"hi\"\tnow", check: func(q queryQuals) bool { return q.Tool == "Bash" }},
+		{query: `"IS NOT NULL" AND users role:user`, pattern: `"IS NOT NULL" AND users`, check: func(q queryQuals) bool { return q.Role == "user" }},
+	}
+	for _, tt := range tests {
+		pattern, q := parseQuery(tt.query)
+		if pattern != tt.pattern {
+			t.Errorf("%q: pattern = %q, want %q", tt.query, pattern, tt.pattern)
+		}
+		if !tt.check(q) {
+			t.Errorf("%q: qualifiers %+v", tt.query, q)
+		}
+	}
+}
+
+func TestQueryQualsApply(t *testing.T) {
+	_, q := parseQuery("role:tool file:*.go project:api after:2025-01-01 x")
+	opts := SearchOpts{Role: "user", Tool: "Bash"}
+	q.apply(&opts)
+	if opts.Role != "tool" || opts.File != "*.go" || opts.Project != "api" || opts.Tool != "Bash" {
+		t.Errorf("apply: got %+v", opts)
+	}
+
+	msg := Message{Type: "user", Kind: "tool_result", Tool: "Bash", Project: "-home-me-src-api", Timestamp: "2025-01-02T00:00:00"}
+	opts.File = ""
+	if !opts.accepts(msg) {
+		t.Error("message should pass project and after filters")
+	}
+	msg.Timestamp = "2024-12-31T23:00:00"
+	opts.Since = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if opts.accepts(msg) {
+		t.Error("message before after: should be rejected")
+	}
+	msg.Project = "-home-me-src-web"
+	msg.Timestamp = "2025-01-02T00:00:00"
+	if opts.accepts(msg) {
+		t.Error("message from another project should be rejected")
+	}
+}
+
+func TestParseDateRelative(t *testing.T) {
+	// Wednesday afternoon
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.Local)
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.Local) }
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-09-01", time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)},
+		{"2026-09-01T08:00:00Z", time.Date(2026, 9, 1, 8, 0, 0, 0, time.UTC)},
+		{"today", day(14)},
+		{"Yesterday", day(13)},
+		{"monday", day(12)},
+		{"last monday", day(12)},
+		{"last wednesday", day(7)},
+		{"last  Fri", day(9)},
+		{"2 weeks ago", now.AddDate(0, 0, -14)},
+		{"an hour ago", now.Add(-time.Hour)},
+		{"3 days ago", now.AddDate(0, 0, -3)},
+		{"1 month ago", now.AddDate(0, -1, 0)},
+		{"last week", now.AddDate(0, 0, -7)},
+	}
+	for _, tt := range tests {
+		got, err := parseDateAt(tt.in, now)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"someday", "2 fortnights ago", "-1 days ago", "last"} {
+		if _, err := parseDateAt(bad, now); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
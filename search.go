@@ -2,24 +2,40 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // SearchStats tracks pre-filter and regex search behavior for diagnostics.
 type SearchStats struct {
 	FilesTotal       int
 	PrefilterSkipped int
+	IndexSkipped     int // of PrefilterSkipped, ruled out by the trigram index unopened
 	RegexSearched    int
 }
 
+// newSearchStats counts a search over total files, of which the trigram
+// index ruled out indexSkipped and the prefilter skipped pfSkipped more.
+func newSearchStats(total, indexSkipped, pfSkipped int) SearchStats {
+	return SearchStats{
+		FilesTotal:       total,
+		PrefilterSkipped: indexSkipped + pfSkipped,
+		IndexSkipped:     indexSkipped,
+		RegexSearched:    total - indexSkipped - pfSkipped,
+	}
+}
+
 // Message represents a parsed chat message from a JSONL session file.
 type Message struct {
 	Role      string
@@ -30,6 +46,27 @@ type Message struct {
 	Project   string
 	FilePath  string
 	MsgIndex  int
+	Kind      string // "text", "thinking", "tool_use" or "tool_result"
+	Tool      string // tool name for tool calls and their results (e.g. "Bash")
+	Target    string // file path a file tool (Read, Edit, Write, ...) operated on
+
+	// Conversation tree. Claude Code links each line to the previous one
+	// on its branch; Task subagents run on sidechains in the same tree.
+	UUID       string // uuid of the JSONL line this message came from
+	Block      int    // position of the message's content block within that line
+	ParentUUID string // parentUuid of that line
+	Sidechain  bool   // part of a subagent (Task) conversation
+	Parent     int    // MsgIndex of the previous message on this branch, -1 at the root
+
+	Title        string // session title from its summary lines
+	Conversation string // first session of a resumed chain (--follow-continuations)
+
+	// Environment recorded on each line by Claude Code
+	Cwd       string
+	GitBranch string
+	Version   string // Claude Code version
+
+	Model string // model that produced an assistant message
 }
 
 // Match represents a search result with optional context.
@@ -37,56 +74,509 @@ type Match struct {
 	Message       Message
 	ContextBefore []Message
 	ContextAfter  []Message
-	Similarity    float32 // only for semantic search
+	Similarity    float32  // only for semantic search
+	Score         float64  // BM25 score, only for keyword search
+	Fused         float64  // --hybrid: rank fusion of Score and Similarity, 0 to 1
+	Term          string   // boolean query term the message matched
+	Partner       *Message // --near: the message matching the second pattern
 }
 
 // SearchOpts holds search parameters.
 type SearchOpts struct {
-	Role        string // "both", "user", "assistant"
+	Role        string // "both", "user", "assistant", "tool"
 	MaxResults  int
 	MaxDays     int
 	MaxAge      time.Duration // if non-zero, overrides MaxDays
 	Before      int
 	After       int
 	ListOnly    bool
-	ExcludeSelf bool // exclude the current (most recent) session
+	ExcludeSelf bool      // exclude the current (most recent) session
+	Tool        string    // if set, only tool_use messages for this tool
+	Thinking    bool      // include assistant thinking blocks
+	File        string    // if set, only file tool calls whose path matches this glob
+	Sidechain   string    // "include" (default), "exclude" or "only" subagent messages
+	Branch      string    // if set, only messages recorded on a matching git branch (glob)
+	Cwd         string    // if set, only messages whose working directory matches (glob)
+	CCVersion   string    // if set, only messages from a matching Claude Code version (glob)
+	Model       string    // if set, only assistant messages from a matching model (glob or substring)
+	Project     string    // if set, only messages from a matching project directory (glob or substring)
+	Since       time.Time // if set, only messages at or after this time
+	Until       time.Time // if set, only messages before this time
+	// Matching modes, as in grep: the pattern is a literal string (-F),
+	// must match whole words (-w), and is case-sensitive.
+	Fixed         bool
+	Word          bool
+	CaseSensitive bool
+	Without       string // drop sessions where any message matches this
+	// FollowContinuations searches whole chains of resumed sessions and
+	// groups their matches as one conversation.
+	FollowContinuations bool
+}
+
+// conflict describes a pair of filters no message can pass together, or
+// returns "". Tool calls are the assistant's, and file: matches only tool
+// calls, not their output.
+func (o SearchOpts) conflict() string {
+	switch {
+	case o.Role == "user" && o.Tool != "":
+		return "tool calls come from the assistant, so -p/role:user with --tool/tool: matches nothing"
+	case o.Role == "user" && o.File != "":
+		return "file: matches tool calls, which come from the assistant, so -p/role:user with file: matches nothing"
+	case o.Role == "tool" && o.File != "":
+		return "file: matches tool calls, not their output, so -t/role:tool with file: matches nothing"
+	}
+	return ""
+}
+
+// accepts reports whether a message passes the role and tool filters.
+// Tool results are only searched with Role "tool": they are bulky and
+// would otherwise drown out prompts and responses.
+func (o SearchOpts) accepts(msg Message) bool {
+	switch o.Role {
+	case "tool":
+		if msg.Kind != "tool_result" {
+			return false
+		}
+	case "user", "assistant":
+		if msg.Type != o.Role || msg.Kind == "tool_result" {
+			return false
+		}
+	default:
+		if msg.Kind == "tool_result" {
+			return false
+		}
+	}
+	if msg.Kind == "thinking" && !o.Thinking {
+		return false
+	}
+	if o.Tool != "" && (msg.Tool == "" || !strings.EqualFold(msg.Tool, o.Tool)) {
+		return false
+	}
+	if o.File != "" && (msg.Kind != "tool_use" || !matchFileGlob(o.File, msg.Target)) {
+		return false
+	}
+	if o.Branch != "" && !matchGlob(o.Branch, msg.GitBranch) {
+		return false
+	}
+	if o.Cwd != "" && !matchFileGlob(o.Cwd, msg.Cwd) && !strings.HasPrefix(msg.Cwd, strings.TrimSuffix(o.Cwd, "/")+"/") {
+		return false
+	}
+	if o.CCVersion != "" && !matchGlob(o.CCVersion, msg.Version) {
+		return false
+	}
+	if o.Model != "" && !matchName(o.Model, msg.Model) {
+		return false
+	}
+	if o.Project != "" && !matchName(o.Project, msg.Project) {
+		return false
+	}
+	if from, to := o.window(); !from.IsZero() || !to.IsZero() {
+		t, err := time.Parse("2006-01-02T15:04:05", msg.Timestamp)
+		switch {
+		case err != nil:
+			// Undated messages pass the -d/-H window (their file's
+			// mtime did) but not an explicit date range
+			if !o.Since.IsZero() || !o.Until.IsZero() {
+				return false
+			}
+		case !from.IsZero() && t.Before(from), !to.IsZero() && !t.Before(to):
+			return false
+		}
+	}
+	switch o.Sidechain {
+	case "exclude":
+		return !msg.Sidechain
+	case "only":
+		return msg.Sidechain
+	}
+	return true
+}
+
+// window returns the time range a message must fall in: from --since
+// (or after:), else the -H or -d age, to --until (or before:). A zero
+// bound is open. With --follow-continuations the age selects whole
+// conversations, so it doesn't apply per message.
+func (o SearchOpts) window() (from, to time.Time) {
+	switch {
+	case !o.Since.IsZero():
+		from = o.Since
+	case o.FollowContinuations:
+	case o.MaxAge > 0:
+		from = time.Now().Add(-o.MaxAge)
+	case o.MaxDays > 0:
+		from = time.Now().Add(-time.Duration(o.MaxDays) * 24 * time.Hour)
+	}
+	return from, o.Until
+}
+
+// resolveWindow reconciles the dates with the -d/-H age once flags and
+// qualifiers are in. --since (after:) replaces the age: the file window
+// starts there. --until (before:) alone opens the window at the start
+// unless -d or -H was given (windowSet), since the default 7 days back
+// from now would leave nothing before an older date.
+func (o *SearchOpts) resolveWindow(windowSet bool) {
+	switch {
+	case !o.Since.IsZero():
+		age := max(time.Since(o.Since), time.Second)
+		o.MaxAge = age
+		o.MaxDays = int(age.Hours()/24) + 1
+	case !o.Until.IsZero() && !windowSet:
+		o.MaxAge, o.MaxDays = 0, 0
+	}
+}
+
+// describeWindow names the time window for hints: "last 7 days", "last
+// 4 hours", "since 2026-09-01", "2026-09-01 to 2026-10-01", "last 30
+// days, before 2026-10-01".
+func (o SearchOpts) describeWindow() string {
+	date := func(t time.Time) string {
+		t = t.Local()
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+			return t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02 15:04")
+	}
+	switch {
+	case !o.Since.IsZero() && !o.Until.IsZero():
+		return date(o.Since) + " to " + date(o.Until)
+	case !o.Since.IsZero():
+		return "since " + date(o.Since)
+	}
+	var age string
+	switch {
+	case o.MaxAge > 0 && o.MaxAge%time.Hour == 0:
+		age = fmt.Sprintf("last %d hours", int(o.MaxAge.Hours()))
+	case o.MaxAge > 0:
+		age = "last " + o.MaxAge.String()
+	case o.MaxDays > 0:
+		age = fmt.Sprintf("last %d days", o.MaxDays)
+	}
+	switch {
+	case !o.Until.IsZero() && age != "":
+		return age + ", before " + date(o.Until)
+	case !o.Until.IsZero():
+		return "before " + date(o.Until)
+	case age != "":
+		return age
+	}
+	return "any time"
+}
+
+// compile compiles a search pattern under the matching modes.
+func (o SearchOpts) compile(pattern string) (*regexp.Regexp, error) {
+	if o.Fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if o.Word {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !o.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// exactCase reports whether the prefilter can match pattern's literals
+// as-is: the search is case-sensitive and the pattern doesn't turn
+// case-insensitivity back on with an inline (?i).
+func (o SearchOpts) exactCase(pattern string) bool {
+	return o.CaseSensitive && (o.Fixed || !strings.Contains(pattern, "(?i"))
+}
+
+// prefilterLiterals returns the literals a file must contain (any of) for
+// pattern to match under the matching modes, or nil to skip the
+// prefilter. They are lowercase unless exactCase.
+func (o SearchOpts) prefilterLiterals(pattern string) [][]byte {
+	fold := !o.exactCase(pattern)
+	if o.Fixed {
+		lit := unescapedRun(pattern)
+		if lit == "" {
+			return nil
+		}
+		if fold {
+			lit = strings.ToLower(lit)
+		}
+		return [][]byte{[]byte(lit)}
+	}
+	return extractLiterals(pattern, fold)
+}
+
+// unescapedRun returns the longest run of lit that JSON writes as is.
+// Files are prefiltered as raw JSONL, where quotes, backslashes and
+// control characters are escaped, so a literal spanning one of them would
+// rule out the very lines that contain it.
+func unescapedRun(lit string) string {
+	best, start := "", 0
+	for i := 0; i <= len(lit); i++ {
+		if i < len(lit) && lit[i] != '"' && lit[i] != '\\' && lit[i] >= 0x20 {
+			continue
+		}
+		if i-start > len(best) {
+			best = lit[start:i]
+		}
+		start = i + 1
+	}
+	return best
+}
+
+// hasUpper reports whether a pattern asks for case-sensitive matching
+// under smart case (-S): it has an uppercase letter outside escapes like
+// \S or \W. Every letter counts in a fixed string.
+func hasUpper(pattern string, fixed bool) bool {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && !fixed:
+			escaped = true
+		case unicode.IsUpper(r):
+			return true
+		}
+	}
+	return false
+}
+
+// matchName reports whether a name (model ID, project directory) matches
+// a glob or contains the pattern, ignoring case, so "sonnet" and
+// "claude-opus-4*" both work.
+func matchName(pattern, name string) bool {
+	if name == "" {
+		return false
+	}
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	return strings.Contains(name, pattern) || matchGlob(pattern, name)
+}
+
+// matchGlob reports whether s equals pattern or matches it as a glob.
+// "*" does not cross "/", so "feat/*" matches "feat/payments".
+func matchGlob(pattern, s string) bool {
+	if s == pattern {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, s)
+	return ok
+}
+
+// matchFileGlob reports whether path matches glob, either in full or as a
+// trailing path suffix, so "billing/invoice.go" and "*.go" both match
+// "/src/internal/billing/invoice.go".
+func matchFileGlob(glob, path string) bool {
+	if path == "" {
+		return false
+	}
+	if ok, _ := filepath.Match(glob, path); ok {
+		return true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if ok, _ := filepath.Match(glob, path[i+1:]); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // regexSearch finds matches across session files using regex.
 func regexSearch(pattern, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
-	re, err := regexp.Compile("(?i)" + pattern)
+	return multiSearch([]string{pattern}, searchPath, opts)
+}
+
+// multiSearch is regexSearch for several patterns (-e, -f) in one pass
+// over the files: a message matches if any pattern does, and with more
+// than one pattern each match's Term names the patterns that hit it.
+func multiSearch(patterns []string, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
+	ps, err := compilePatterns(patterns, opts)
 	if err != nil {
 		return nil, SearchStats{}, err
 	}
 
-	var files []string
-	if opts.MaxAge > 0 {
-		files, err = findSessionFilesWithAge(searchPath, opts.MaxAge)
-	} else {
-		files, err = findSessionFiles(searchPath, opts.MaxDays)
+	files, conversations, err := searchScope(searchPath, opts)
+	if err != nil {
+		return nil, SearchStats{}, err
+	}
+
+	candidates, ruledOut := trigramFilter(files, ps.groups())
+	results, pfSkipped := searchEach(candidates, func(fp string) ([]Match, bool) {
+		return searchFileTracked(fp, ps, opts)
+	})
+
+	var allMatches []Match
+	for _, r := range results {
+		allMatches = append(allMatches, r...)
+	}
+	for i := range allMatches {
+		allMatches[i].Message.Conversation = conversations[allMatches[i].Message.FilePath]
+	}
+
+	// Sort by timestamp descending (newest first)
+	sort.Slice(allMatches, func(i, j int) bool {
+		return allMatches[i].Message.Timestamp > allMatches[j].Message.Timestamp
+	})
+
+	// Limit results
+	if len(allMatches) > opts.MaxResults {
+		allMatches = allMatches[:opts.MaxResults]
 	}
+
+	return allMatches, newSearchStats(len(files), len(ruledOut), pfSkipped), nil
+}
+
+// invertSearch lists the sessions in scope where no message matches any
+// of the patterns, like grep -L: one Match per session, carrying its IDs
+// and the file's modification time, most recently modified first.
+func invertSearch(patterns []string, searchPath string, opts SearchOpts) ([]Match, SearchStats, error) {
+	opts.Before, opts.After = 0, 0
+	ps, err := compilePatterns(patterns, opts)
 	if err != nil {
 		return nil, SearchStats{}, err
 	}
 
-	// Exclude current session (most recently modified file)
-	if opts.ExcludeSelf && len(files) > 0 {
-		files = excludeNewestFile(files)
+	files, _, err := searchScope(searchPath, opts)
+	if err != nil {
+		return nil, SearchStats{}, err
 	}
 
-	// Concurrent search with fan-in
-	type fileResult struct {
-		matches []Match
+	// Files the trigram index rules out can't match, so they are listed
+	// without being opened.
+	candidates, ruledOut := trigramFilter(files, ps.groups())
+	results, pfSkipped := searchEach(candidates, func(fp string) ([]Match, bool) {
+		matches, skipped := searchFileTracked(fp, ps, opts)
+		if len(matches) > 0 {
+			return nil, skipped
+		}
+		return unmatchedSession(fp), skipped
+	})
+
+	var sessions []Match
+	for _, r := range results {
+		sessions = append(sessions, r...)
+	}
+	for _, fp := range ruledOut {
+		sessions = append(sessions, unmatchedSession(fp)...)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Message.Timestamp > sessions[j].Message.Timestamp
+	})
+	if len(sessions) > opts.MaxResults {
+		sessions = sessions[:opts.MaxResults]
 	}
 
-	results := make(chan fileResult, len(files))
-	var wg sync.WaitGroup
+	return sessions, newSearchStats(len(files), len(ruledOut), pfSkipped), nil
+}
 
-	// Limit concurrency
-	sem := make(chan struct{}, 8)
+// unmatchedSession is the -L entry for a session file, stamped with its
+// modification time; nil if the file is gone.
+func unmatchedSession(fp string) []Match {
+	info, err := os.Stat(fp)
+	if err != nil {
+		return nil
+	}
+	return []Match{{Message: Message{
+		SessionID: extractSessionID(fp),
+		Project:   extractProject(fp),
+		FilePath:  fp,
+		Timestamp: info.ModTime().UTC().Format("2006-01-02T15:04:05"),
+	}}}
+}
 
-	prefilterLiterals := extractPrefilterLiterals(pattern)
-	var pfSkipped int32
+// patternSet is the compiled form of a regex search's patterns.
+type patternSet struct {
+	res       []*regexp.Regexp
+	terms     []string // res[i] labels matches terms[i]; nil for one pattern
+	prefilter [][]byte // a file must contain one of these
+	exact     bool     // prefilter literals are matched as-is
+	without   *regexp.Regexp
+}
+
+// groups returns the prefilter as literal groups for the trigram index.
+func (ps *patternSet) groups() [][][]byte {
+	if ps.prefilter == nil {
+		return nil
+	}
+	return [][][]byte{ps.prefilter}
+}
+
+func compilePatterns(patterns []string, opts SearchOpts) (*patternSet, error) {
+	ps := &patternSet{res: make([]*regexp.Regexp, len(patterns)), exact: true}
+	for i, p := range patterns {
+		re, err := opts.compile(p)
+		if err != nil {
+			return nil, err
+		}
+		ps.res[i] = re
+		ps.exact = ps.exact && opts.exactCase(p)
+	}
+	if len(patterns) > 1 {
+		ps.terms = patterns
+	}
+	without, err := opts.withoutRe()
+	if err != nil {
+		return nil, err
+	}
+	ps.without = without
+
+	// All literals form one OR set; a pattern without literals could
+	// match any file, so it disables the prefilter. Folded and exact
+	// literals can't share one pass, so fold all if any needs it.
+	o := opts
+	o.CaseSensitive = ps.exact
+	for _, p := range patterns {
+		lits := o.prefilterLiterals(p)
+		if lits == nil {
+			ps.prefilter = nil
+			break
+		}
+		ps.prefilter = append(ps.prefilter, lits...)
+	}
+	if ps.prefilter == nil && opts.File != "" {
+		// No literal in the pattern — the path itself must appear in the file
+		if lit := longestGlobLiteral(opts.File); lit != "" {
+			if !ps.exact {
+				lit = strings.ToLower(lit)
+			}
+			ps.prefilter = [][]byte{[]byte(lit)}
+		}
+	}
+	return ps, nil
+}
+
+// withoutRe compiles the --without pattern, or returns nil if unset.
+func (o SearchOpts) withoutRe() (*regexp.Regexp, error) {
+	if o.Without == "" {
+		return nil, nil
+	}
+	re, err := o.compile(o.Without)
+	if err != nil {
+		return nil, fmt.Errorf("--without: %w", err)
+	}
+	return re, nil
+}
+
+// mentions reports whether any message of a session matches re,
+// whatever the filters. A nil re mentions nothing.
+func mentions(messages []Message, re *regexp.Regexp) bool {
+	if re == nil {
+		return false
+	}
+	for _, msg := range messages {
+		if re.MatchString(msg.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchEach runs fn over session files concurrently (8 at a time) and
+// collects the non-empty results, one slice per file in no particular
+// order, plus how many files fn reported as skipped by the prefilter.
+func searchEach(files []string, fn func(fpath string) ([]Match, bool)) ([][]Match, int) {
+	results := make(chan []Match, len(files))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	var skipped int32
 
 	for _, f := range files {
 		wg.Add(1)
@@ -95,43 +585,86 @@ func regexSearch(pattern, searchPath string, opts SearchOpts) ([]Match, SearchSt
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			matches, skipped := searchFileTracked(fp, re, prefilterLiterals, opts)
-			if skipped {
-				atomic.AddInt32(&pfSkipped, 1)
+			matches, pfSkipped := fn(fp)
+			if pfSkipped {
+				atomic.AddInt32(&skipped, 1)
 			}
 			if len(matches) > 0 {
-				results <- fileResult{matches: matches}
+				results <- matches
 			}
 		}(f)
 	}
-
 	go func() {
 		wg.Wait()
 		close(results)
 	}()
 
-	var allMatches []Match
+	var out [][]Match
 	for r := range results {
-		allMatches = append(allMatches, r.matches...)
+		out = append(out, r)
 	}
+	return out, int(skipped)
+}
 
-	// Sort by timestamp descending (newest first)
-	sort.Slice(allMatches, func(i, j int) bool {
-		return allMatches[i].Message.Timestamp > allMatches[j].Message.Timestamp
-	})
+// readSession parses a session file if it passes the prefilter: at least
+// one literal of every group (see prefilterAllReader). The file is
+// streamed twice — once for the prefilter, once to parse — so memory stays
+// bounded no matter how large the session is.
+func readSession(fpath string, groups [][][]byte, exact bool) (messages []Message, prefilterSkipped bool) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
 
-	// Limit results
-	if len(allMatches) > opts.MaxResults {
-		allMatches = allMatches[:opts.MaxResults]
+	if len(groups) > 0 {
+		ok, err := prefilterAllReader(f, groups, exact)
+		if err != nil {
+			return nil, false
+		}
+		if !ok {
+			return nil, true
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, false
+		}
+	}
+
+	messages, _ = parseJSONLReader(fpath, f)
+	return messages, false
+}
+
+// searchScope lists the session files a search covers: those within the
+// age window, minus the current session, plus the rest of their resumed
+// chains with --follow-continuations (mapped to the chain's first session).
+func searchScope(searchPath string, opts SearchOpts) ([]string, map[string]string, error) {
+	var files []string
+	var err error
+	if opts.MaxAge > 0 {
+		files, err = findSessionFilesWithAge(searchPath, opts.MaxAge)
+	} else {
+		files, err = findSessionFiles(searchPath, opts.MaxDays)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
-	stats := SearchStats{
-		FilesTotal:       len(files),
-		PrefilterSkipped: int(pfSkipped),
-		RegexSearched:    len(files) - int(pfSkipped),
+	// Exclude current session (most recently modified file)
+	var self string
+	if opts.ExcludeSelf && len(files) > 1 {
+		if i := newestFile(files); i >= 0 {
+			self = files[i]
+			files = append(files[:i], files[i+1:]...)
+		}
 	}
 
-	return allMatches, stats, nil
+	// Pull in every session of a resumed chain, even outside the age
+	// window, but never the current session
+	var conversations map[string]string
+	if opts.FollowContinuations {
+		files, conversations = expandContinuations(files, self)
+	}
+	return files, conversations, nil
 }
 
 // findSessionFiles finds JSONL files modified within the given time range.
@@ -140,7 +673,19 @@ func findSessionFiles(searchPath string, maxDays int) ([]string, error) {
 }
 
 func findSessionFilesWithAge(searchPath string, maxAge time.Duration) ([]string, error) {
+	// A session asked for by ID is searched whatever its age
+	if isSessionFile(searchPath) {
+		if _, err := os.Stat(searchPath); err != nil {
+			return nil, err
+		}
+		return []string{searchPath}, nil
+	}
+
+	// No age (-d 0, or --until alone) means no cutoff
 	cutoff := time.Now().Add(-maxAge)
+	if maxAge <= 0 {
+		cutoff = time.Time{}
+	}
 	var files []string
 
 	err := filepath.Walk(searchPath, func(path string, info os.FileInfo, err error) error {
@@ -164,52 +709,47 @@ func findSessionFilesWithAge(searchPath string, maxAge time.Duration) ([]string,
 }
 
 // searchFileTracked searches a single JSONL file and reports whether the prefilter skipped it.
-func searchFileTracked(filepath string, re *regexp.Regexp, prefilter [][]byte, opts SearchOpts) (matches []Match, prefilterSkipped bool) {
-	data, err := os.ReadFile(filepath)
-	if err != nil {
-		return nil, false
-	}
-
+// A message matching any of the patterns is a match, labelled with those
+// that hit when there are several. A session mentioning the --without
+// pattern has no matches.
+func searchFileTracked(filepath string, ps *patternSet, opts SearchOpts) (matches []Match, prefilterSkipped bool) {
 	// Quick check: does the file even contain any prefilter literal?
-	if !prefilterMatch(data, prefilter) {
-		return nil, true
+	var groups [][][]byte
+	if len(ps.prefilter) > 0 {
+		groups = [][][]byte{ps.prefilter}
 	}
-
-	messages := parseJSONL(filepath, data)
-	if len(messages) == 0 {
-		return nil, false
+	messages, skipped := readSession(filepath, groups, ps.exact)
+	if len(messages) == 0 || mentions(messages, ps.without) {
+		return nil, skipped
 	}
 
-	for i, msg := range messages {
-		if opts.Role != "both" && msg.Type != opts.Role {
-			continue
-		}
-		if !re.MatchString(msg.Text) {
+	var t *thread
+	for _, msg := range messages {
+		if !opts.accepts(msg) {
 			continue
 		}
-
-		m := Match{Message: msg}
-
-		// Context before
-		if opts.Before > 0 {
-			start := i - opts.Before
-			if start < 0 {
-				start = 0
+		var hit []string
+		for i, re := range ps.res {
+			if !re.MatchString(msg.Text) {
+				continue
 			}
-			for j := start; j < i; j++ {
-				m.ContextBefore = append(m.ContextBefore, messages[j])
+			if ps.terms == nil {
+				hit = append(hit, "")
+				break
 			}
+			hit = append(hit, ps.terms[i])
+		}
+		if len(hit) == 0 {
+			continue
 		}
 
-		// Context after
-		if opts.After > 0 {
-			end := i + opts.After + 1
-			if end > len(messages) {
-				end = len(messages)
-			}
-			for j := i + 1; j < end; j++ {
-				m.ContextAfter = append(m.ContextAfter, messages[j])
+		m := Match{Message: msg, Term: strings.Join(hit, ", ")}
+		if opts.Before > 0 || opts.After > 0 {
+			if t == nil {
+				t = newThread(messages)
 			}
+			m.ContextBefore = t.before(msg.MsgIndex, opts.Before)
+			m.ContextAfter = t.after(msg.MsgIndex, opts.After)
 		}
 
 		matches = append(matches, m)
@@ -218,168 +758,135 @@ func searchFileTracked(filepath string, re *regexp.Regexp, prefilter [][]byte, o
 	return matches, false
 }
 
-// parseJSONL parses a JSONL file into messages.
-func parseJSONL(fpath string, data []byte) []Message {
-	sessionID := extractSessionID(fpath)
-	project := extractProject(fpath)
-
-	var messages []Message
-	idx := 0
+// thread indexes one session's conversation tree so context follows the
+// branch a message is on rather than line order in the file.
+type thread struct {
+	messages []Message
+	children [][]int
+}
 
-	for _, line := range bytes.Split(data, []byte("\n")) {
-		if len(line) == 0 {
-			continue
-		}
-
-		var raw map[string]json.RawMessage
-		if err := json.Unmarshal(line, &raw); err != nil {
-			continue
+func newThread(messages []Message) *thread {
+	t := &thread{messages: messages, children: make([][]int, len(messages))}
+	for i, m := range messages {
+		if m.Parent >= 0 && m.Parent < len(messages) {
+			t.children[m.Parent] = append(t.children[m.Parent], i)
 		}
+	}
+	return t
+}
 
-		// Get type field
-		var msgType string
-		if t, ok := raw["type"]; ok {
-			json.Unmarshal(t, &msgType)
-		}
-		if msgType != "user" && msgType != "assistant" {
-			continue
-		}
+// before returns up to n ancestors of message i, oldest first.
+func (t *thread) before(i, n int) []Message {
+	var out []Message
+	for j := t.messages[i].Parent; j >= 0 && len(out) < n; j = t.messages[j].Parent {
+		out = append(out, t.messages[j])
+	}
+	slices.Reverse(out)
+	return out
+}
 
-		// Get timestamp
-		var timestamp string
-		if ts, ok := raw["timestamp"]; ok {
-			json.Unmarshal(ts, &timestamp)
-			if len(timestamp) > 19 {
-				timestamp = timestamp[:19]
+// after returns up to n descendants of message i along one branch. Where
+// the conversation forks it stays on the same side of a sidechain and
+// takes the latest child — the branch a rewind or retry continued on.
+func (t *thread) after(i, n int) []Message {
+	var out []Message
+	for len(out) < n {
+		next, same := -1, false
+		for _, c := range t.children[i] {
+			if s := t.messages[c].Sidechain == t.messages[i].Sidechain; s || !same {
+				next, same = c, s
 			}
 		}
-
-		// Get message content
-		text := extractText(raw)
-		if text == "" {
-			continue
-		}
-
-		msg := Message{
-			Role:      msgType,
-			Type:      msgType,
-			Text:      text,
-			Timestamp: timestamp,
-			SessionID: sessionID,
-			Project:   project,
-			FilePath:  fpath,
-			MsgIndex:  idx,
-		}
-
-		// Deduplicate: same timestamp+role → keep latest
-		if len(messages) > 0 {
-			prev := &messages[len(messages)-1]
-			if prev.Timestamp == timestamp && prev.Role == msgType {
-				*prev = msg
-				continue
-			}
+		if next < 0 {
+			break
 		}
-
-		messages = append(messages, msg)
-		idx++
+		out = append(out, t.messages[next])
+		i = next
 	}
+	return out
+}
 
-	// Fix MsgIndex after dedup
-	for i := range messages {
-		messages[i].MsgIndex = i
-	}
+// extractSessionID returns the full session ID (the file name's UUID), as
+// accepted by claude --resume. Use shortID for display.
+func extractSessionID(fpath string) string {
+	base := filepath.Base(fpath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
 
-	return messages
+// shortID abbreviates a session ID for terminal display.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
 }
 
-// extractText pulls text content from the message field.
-func extractText(raw map[string]json.RawMessage) string {
-	// Try message.content first
-	var msgObj map[string]json.RawMessage
-	if m, ok := raw["message"]; ok {
-		if err := json.Unmarshal(m, &msgObj); err != nil {
-			// Try data.message
-			if d, ok := raw["data"]; ok {
-				var dataObj map[string]json.RawMessage
-				if err := json.Unmarshal(d, &dataObj); err == nil {
-					if dm, ok := dataObj["message"]; ok {
-						json.Unmarshal(dm, &msgObj)
-					}
-				}
-			}
+// findSessionFile resolves a session ID or unique ID prefix to its file
+// under base. An exact ID wins over longer IDs it prefixes.
+func findSessionFile(base, prefix string) (string, error) {
+	var found []string
+	filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jsonl") {
+			return nil
 		}
-	}
+		if strings.HasPrefix(extractSessionID(path), prefix) {
+			found = append(found, path)
+		}
+		return nil
+	})
 
-	if msgObj == nil {
-		return ""
+	for _, f := range found {
+		if extractSessionID(f) == prefix {
+			return f, nil
+		}
 	}
-
-	contentRaw, ok := msgObj["content"]
-	if !ok {
-		return ""
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no session matching %q", prefix)
+	case 1:
+		return found[0], nil
 	}
-
-	// Try as string
-	var strContent string
-	if err := json.Unmarshal(contentRaw, &strContent); err == nil {
-		return strings.TrimSpace(strContent)
+	sort.Strings(found)
+	var ids []string
+	for _, f := range found[:min(len(found), 5)] {
+		ids = append(ids, extractProject(f)+"/"+extractSessionID(f))
 	}
-
-	// Try as array of content blocks
-	var blocks []map[string]json.RawMessage
-	if err := json.Unmarshal(contentRaw, &blocks); err == nil {
-		var texts []string
-		for _, block := range blocks {
-			var blockType string
-			if t, ok := block["type"]; ok {
-				json.Unmarshal(t, &blockType)
-			}
-			if blockType != "text" {
-				continue
-			}
-			var text string
-			if t, ok := block["text"]; ok {
-				json.Unmarshal(t, &text)
-			}
-			if text != "" {
-				texts = append(texts, text)
-			}
-		}
-		return strings.TrimSpace(strings.Join(texts, " "))
+	more := ""
+	if len(found) > 5 {
+		more = fmt.Sprintf(" and %d more", len(found)-5)
 	}
-
-	return ""
+	return "", fmt.Errorf("session prefix %q is ambiguous — matches %s%s", prefix, strings.Join(ids, ", "), more)
 }
 
-func extractSessionID(fpath string) string {
-	base := filepath.Base(fpath)
-	ext := filepath.Ext(base)
-	id := strings.TrimSuffix(base, ext)
-	if len(id) > 12 {
-		return id[:12]
-	}
-	return id
+// isSessionFile reports whether a search path names a single session
+// file (--session) rather than a projects directory.
+func isSessionFile(searchPath string) bool {
+	return strings.HasSuffix(searchPath, ".jsonl")
 }
 
 func extractProject(fpath string) string {
 	return filepath.Base(filepath.Dir(fpath))
 }
 
-// extractPrefilterLiterals extracts literal byte strings from a regex pattern
-// for fast file-level pre-filtering with bytes.Contains. For alternation
-// patterns like (a|b|c), returns each branch's longest literal. Returns nil
-// if no useful literals can be extracted (pre-filter is skipped).
-func extractPrefilterLiterals(pattern string) [][]byte {
+// extractLiterals extracts literal byte strings from a regex pattern for
+// fast file-level pre-filtering. For alternation patterns like (a|b|c),
+// returns each branch's longest literal. Returns nil if no useful literals
+// can be extracted (pre-filter is skipped). Literals are lowercased only
+// if fold is set.
+func extractLiterals(pattern string, fold bool) [][]byte {
 	p := stripOuterGroup(pattern)
 	parts := splitTopLevelPipe(p)
 
 	var literals [][]byte
 	for _, part := range parts {
-		lit := longestLiteral(strings.Trim(part, "()"))
+		lit := unescapedRun(longestLiteral(strings.Trim(part, "()")))
 		if lit == "" {
 			return nil // can't pre-filter this branch
 		}
-		literals = append(literals, []byte(strings.ToLower(lit)))
+		if fold {
+			lit = strings.ToLower(lit)
+		}
+		literals = append(literals, []byte(lit))
 	}
 	if len(literals) == 0 {
 		return nil
@@ -438,6 +945,9 @@ func splitTopLevelPipe(s string) []string {
 }
 
 // longestLiteral finds the longest contiguous non-metacharacter substring.
+// An escaped punctuation character is literal (\. is a dot), but an
+// escaped letter or digit is a class or a character code (\s, \d, \b,
+// \pL, \x41) and ends the run like any metacharacter.
 func longestLiteral(s string) string {
 	best := ""
 	var current strings.Builder
@@ -445,8 +955,16 @@ func longestLiteral(s string) string {
 	for i := 0; i < len(s); i++ {
 		c := s[i]
 		if c == '\\' && i+1 < len(s) {
-			current.WriteByte(s[i+1])
-			i++
+			if next := s[i+1]; !isASCIIAlnum(next) {
+				current.WriteByte(next)
+				i++
+				continue
+			}
+			i += 1 + escapeArgLen(s[i+1], s[i+2:])
+			if current.Len() > len(best) {
+				best = current.String()
+			}
+			current.Reset()
 			continue
 		}
 		if isRegexMeta(c) {
@@ -464,6 +982,49 @@ func longestLiteral(s string) string {
 	return best
 }
 
+// escapeArgLen is how many bytes of rest belong to the escape \c: the
+// class name of \pL or \p{Greek}, the hex digits of \x41 or \x{41}, and
+// the further octal digits of \101.
+func escapeArgLen(c byte, rest string) int {
+	switch {
+	case c == 'p' || c == 'P' || c == 'x':
+		if strings.HasPrefix(rest, "{") {
+			if end := strings.IndexByte(rest, '}'); end >= 0 {
+				return end + 1
+			}
+			return len(rest)
+		}
+		if c == 'x' {
+			return min(2, len(rest))
+		}
+		return min(1, len(rest))
+	case c >= '0' && c <= '7':
+		n := 0
+		for n < 2 && n < len(rest) && rest[n] >= '0' && rest[n] <= '7' {
+			n++
+		}
+		return n
+	}
+	return 0
+}
+
+func isASCIIAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// longestGlobLiteral finds the longest run of a glob without wildcards.
+func longestGlobLiteral(glob string) string {
+	best := ""
+	for _, part := range strings.FieldsFunc(glob, func(r rune) bool {
+		return r == '*' || r == '?' || r == '[' || r == ']' || r == '\\'
+	}) {
+		if len(part) > len(best) {
+			best = part
+		}
+	}
+	return best
+}
+
 func isRegexMeta(c byte) bool {
 	return c == '.' || c == '+' || c == '*' || c == '?' ||
 		c == '^' || c == '$' || c == '{' || c == '}' ||
@@ -494,13 +1055,10 @@ func findNewestSessionFile(searchPath string) string {
 	return newest
 }
 
-// excludeNewestFile removes the most recently modified file from the list.
-// Used to skip the current session's file (which is being written to right now).
-func excludeNewestFile(files []string) []string {
-	if len(files) <= 1 {
-		return files
-	}
-
+// newestFile returns the index of the most recently modified file, or -1
+// unless it was modified within the last 60 seconds (likely the current
+// session).
+func newestFile(files []string) int {
 	newestIdx := 0
 	var newestMod time.Time
 	for i, f := range files {
@@ -514,25 +1072,184 @@ func excludeNewestFile(files []string) []string {
 		}
 	}
 
-	// Only exclude if modified within the last 60 seconds (likely current session)
-	if time.Since(newestMod) > 60*time.Second {
-		return files
+	if len(files) == 0 || time.Since(newestMod) > 60*time.Second {
+		return -1
 	}
-
-	return append(files[:newestIdx], files[newestIdx+1:]...)
+	return newestIdx
 }
 
-// prefilterMatch checks if file data contains any of the prefilter literals.
-// Returns true if prefilter is nil/empty (disabled) or any literal matches.
-func prefilterMatch(data []byte, literals [][]byte) bool {
+// prefilterReader reports whether a stream contains any of the lowercase
+// prefilter literals, case-insensitively, reading it in fixed chunks.
+// Returns true if there are no literals (pre-filter disabled).
+func prefilterReader(r io.Reader, literals [][]byte) (bool, error) {
 	if len(literals) == 0 {
-		return true
+		return true, nil
+	}
+	m := newFoldMatcher(literals)
+	buf := make([]byte, lineBufSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 && m.write(buf[:n]) {
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// prefilterAllReader reports whether a stream contains at least one
+// literal of every group, reading it once. Empty groups always pass.
+// Literals are lowercase and matched case-insensitively unless exact.
+func prefilterAllReader(r io.Reader, groups [][][]byte, exact bool) (bool, error) {
+	var pending []*foldMatcher
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		if exact {
+			pending = append(pending, newExactMatcher(g))
+		} else {
+			pending = append(pending, newFoldMatcher(g))
+		}
 	}
-	lower := bytes.ToLower(data)
+	buf := make([]byte, lineBufSize)
+	for len(pending) > 0 {
+		n, err := r.Read(buf)
+		if n > 0 {
+			pending = slices.DeleteFunc(pending, func(m *foldMatcher) bool {
+				return m.write(buf[:n])
+			})
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(pending) == 0, nil
+}
+
+// foldMatcher looks for lowercase literals in a byte stream fed in chunks,
+// case-folding each chunk into a reused scratch buffer instead of copying
+// the whole input. The lowered tail of each chunk is carried over so
+// literals spanning a chunk boundary are still found. An exact matcher
+// (case-sensitive search) skips folding and searches chunks in place.
+type foldMatcher struct {
+	literals [][]byte
+	overlap  int    // bytes of lowered tail to keep: longest literal - 1
+	buf      []byte // lowered tail + lowered current chunk
+	partial  []byte // incomplete UTF-8 sequence at the end of the last chunk
+	exact    bool   // literals are matched as-is
+}
+
+func newExactMatcher(literals [][]byte) *foldMatcher {
+	m := newFoldMatcher(literals)
+	m.exact = true
+	return m
+}
+
+func newFoldMatcher(literals [][]byte) *foldMatcher {
+	m := &foldMatcher{literals: literals}
 	for _, lit := range literals {
-		if bytes.Contains(lower, lit) {
+		m.overlap = max(m.overlap, len(lit)-1)
+	}
+	return m
+}
+
+// write feeds the next chunk and reports whether any literal has been seen.
+func (m *foldMatcher) write(p []byte) bool {
+	if m.exact {
+		return m.writeExact(p)
+	}
+	// Hold back a trailing incomplete rune so it is lowered whole next time
+	if len(m.partial) > 0 {
+		p = append(m.partial, p...)
+		m.partial = nil
+	}
+	if cut := incompleteRuneStart(p); cut < len(p) {
+		m.partial = append([]byte(nil), p[cut:]...)
+		p = p[:cut]
+	}
+
+	m.buf = appendLower(m.buf, p)
+	for _, lit := range m.literals {
+		if bytes.Contains(m.buf, lit) {
 			return true
 		}
 	}
+	if len(m.buf) > m.overlap {
+		n := copy(m.buf, m.buf[len(m.buf)-m.overlap:])
+		m.buf = m.buf[:n]
+	}
 	return false
 }
+
+// writeExact searches the chunk where it lies; only the seam with the
+// previous chunk is copied, to catch literals spanning the boundary.
+func (m *foldMatcher) writeExact(p []byte) bool {
+	for _, lit := range m.literals {
+		if bytes.Contains(p, lit) {
+			return true
+		}
+	}
+	if m.overlap == 0 {
+		return false
+	}
+	m.buf = append(m.buf, p[:min(len(p), m.overlap)]...)
+	for _, lit := range m.literals {
+		if bytes.Contains(m.buf, lit) {
+			return true
+		}
+	}
+	// Keep the last overlap bytes seen
+	if len(p) >= m.overlap {
+		m.buf = append(m.buf[:0], p[len(p)-m.overlap:]...)
+	} else if len(m.buf) > m.overlap {
+		n := copy(m.buf, m.buf[len(m.buf)-m.overlap:])
+		m.buf = m.buf[:n]
+	}
+	return false
+}
+
+// appendLower appends the lowercase form of p to dst, matching
+// bytes.ToLower for valid UTF-8 with an ASCII fast path.
+func appendLower(dst, p []byte) []byte {
+	for i := 0; i < len(p); {
+		c := p[i]
+		if c < utf8.RuneSelf {
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			dst = append(dst, c)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(p[i:])
+		if r == utf8.RuneError {
+			dst = append(dst, p[i:i+size]...)
+		} else {
+			dst = utf8.AppendRune(dst, unicode.ToLower(r))
+		}
+		i += size
+	}
+	return dst
+}
+
+// incompleteRuneStart returns the index where a trailing incomplete UTF-8
+// sequence begins, or len(p) if p ends on a rune boundary.
+func incompleteRuneStart(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestExtractPrefilterLiterals(t *testing.T) {
+func TestExtractLiterals(t *testing.T) {
 	tests := []struct {
 		pattern string
 		want    []string // nil means pre-filter disabled
@@ -38,7 +41,7 @@ func TestExtractPrefilterLiterals(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.pattern, func(t *testing.T) {
-			got := extractPrefilterLiterals(tt.pattern)
+			got := extractLiterals(tt.pattern, true)
 			if tt.want == nil {
 				if got != nil {
 					t.Errorf("want nil, got %v", got)
@@ -57,26 +60,29 @@ func TestExtractPrefilterLiterals(t *testing.T) {
 	}
 }
 
-func TestPrefilterMatch(t *testing.T) {
+func TestPrefilterAllReaderGroup(t *testing.T) {
 	data := []byte("The OpenClaw framework has a Heartbeat feature")
 
 	tests := []struct {
 		name     string
 		literals [][]byte
+		exact    bool
 		want     bool
 	}{
-		{"nil literals — always match", nil, true},
-		{"empty literals — always match", [][]byte{}, true},
-		{"single match", [][]byte{[]byte("openclaw")}, true},
-		{"single no match", [][]byte{[]byte("zzzzz")}, false},
-		{"alternation — first matches", [][]byte{[]byte("openclaw"), []byte("gateway")}, true},
-		{"alternation — second matches", [][]byte{[]byte("gateway"), []byte("heartbeat")}, true},
-		{"alternation — none match", [][]byte{[]byte("gateway"), []byte("zzzzz")}, false},
+		{"nil literals — always match", nil, false, true},
+		{"empty literals — always match", [][]byte{}, false, true},
+		{"single match", [][]byte{[]byte("openclaw")}, false, true},
+		{"single no match", [][]byte{[]byte("zzzzz")}, false, false},
+		{"alternation — first matches", [][]byte{[]byte("openclaw"), []byte("gateway")}, false, true},
+		{"alternation — second matches", [][]byte{[]byte("gateway"), []byte("heartbeat")}, false, true},
+		{"alternation — none match", [][]byte{[]byte("gateway"), []byte("zzzzz")}, false, false},
+		{"exact — same case", [][]byte{[]byte("OpenClaw")}, true, true},
+		{"exact — other case", [][]byte{[]byte("openclaw")}, true, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := prefilterMatch(data, tt.literals)
+			got, _ := prefilterAllReader(bytes.NewReader(data), [][][]byte{tt.literals}, tt.exact)
 			if got != tt.want {
 				t.Errorf("got %v, want %v", got, tt.want)
 			}
@@ -155,15 +161,8 @@ func TestExcludeNewestFile(t *testing.T) {
 	// fresh keeps its current mtime (within 60s)
 
 	files := []string{old, mid, fresh}
-	result := excludeNewestFile(files)
-
-	if len(result) != 2 {
-		t.Fatalf("expected 2 files, got %d", len(result))
-	}
-	for _, f := range result {
-		if f == fresh {
-			t.Error("fresh file should have been excluded")
-		}
+	if i := newestFile(files); i != 2 {
+		t.Errorf("newest file: got %d, want 2 (fresh)", i)
 	}
 }
 
@@ -183,10 +182,8 @@ func TestExcludeNewestFileAllOld(t *testing.T) {
 	os.Chtimes(b, past, past)
 
 	files := []string{a, b}
-	result := excludeNewestFile(files)
-
-	if len(result) != 2 {
-		t.Fatalf("expected 2 files (none excluded), got %d", len(result))
+	if i := newestFile(files); i != -1 {
+		t.Errorf("got %d, want -1 (none excluded)", i)
 	}
 }
 
@@ -196,11 +193,36 @@ func TestExcludeNewestFileSingleFile(t *testing.T) {
 	f := filepath.Join(dir, "only.jsonl")
 	os.WriteFile(f, []byte("{}"), 0644)
 
-	files := []string{f}
-	result := excludeNewestFile(files)
+	files, _, err := searchScope(dir, SearchOpts{MaxDays: 1, ExcludeSelf: true})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("single file should not be excluded, got %d (err %v)", len(files), err)
+	}
+}
 
-	if len(result) != 1 {
-		t.Fatalf("single file should not be excluded, got %d", len(result))
+func TestSearchOptsConflict(t *testing.T) {
+	toolCall := Message{Type: "assistant", Kind: "tool_use", Tool: "Bash", Target: "/src/db.go"}
+	toolOutput := Message{Type: "user", Kind: "tool_result", Tool: "Bash"}
+	for _, o := range []SearchOpts{
+		{Role: "user", Tool: "Bash"},
+		{Role: "user", File: "*.go"},
+		{Role: "tool", File: "*.go"},
+	} {
+		if o.conflict() == "" {
+			t.Errorf("%+v: want a conflict", o)
+		}
+		if o.accepts(toolCall) || o.accepts(toolOutput) {
+			t.Errorf("%+v: accepts a tool message, so it isn't a conflict", o)
+		}
+	}
+	for _, o := range []SearchOpts{
+		{Role: "both", Tool: "Bash"},
+		{Role: "assistant", File: "*.go"},
+		{Role: "tool", Tool: "Bash"},
+		{Role: "user"},
+	} {
+		if msg := o.conflict(); msg != "" {
+			t.Errorf("%+v: unexpected conflict %q", o, msg)
+		}
 	}
 }
 
@@ -213,6 +235,13 @@ func TestLongestLiteral(t *testing.T) {
 		{"a.*long_literal", "long_literal"},
 		{".*", ""},
 		{"abc\\.def", "abc.def"},        // escaped dot is literal
+		{`ok\s`, "ok"},                  // \s is a class, not the letter s
+		{`\d+ms elapsed`, "ms elapsed"},
+		{`ab\bmore`, "more"},
+		{`\pLetters`, "etters"},         // \pL is a class
+		{`\p{Greek}alpha`, "alpha"},
+		{`\x41BCD`, "BCD"},              // \x41 is a character code
+		{`\101xyz`, "xyz"},              // octal
 	}
 
 	for _, tt := range tests {
@@ -224,3 +253,465 @@ func TestLongestLiteral(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchOptsAcceptsTool(t *testing.T) {
+	bash := Message{Type: "assistant", Kind: "tool_use", Tool: "Bash"}
+	prose := Message{Type: "assistant", Kind: "text"}
+
+	opts := SearchOpts{Role: "both", Tool: "bash"}
+	if !opts.accepts(bash) {
+		t.Error("--tool bash should accept Bash calls (case-insensitive)")
+	}
+	if opts.accepts(prose) {
+		t.Error("--tool should reject prose messages")
+	}
+	if (SearchOpts{Role: "both", Tool: "Edit"}).accepts(bash) {
+		t.Error("--tool Edit should reject Bash calls")
+	}
+	if !(SearchOpts{Role: "both"}).accepts(prose) {
+		t.Error("no tool filter should accept prose")
+	}
+}
+
+func TestMatchFileGlob(t *testing.T) {
+	path := "/src/internal/billing/invoice.go"
+	tests := []struct {
+		glob string
+		want bool
+	}{
+		{path, true},
+		{"invoice.go", true},
+		{"billing/invoice.go", true},
+		{"*.go", true},
+		{"internal/*/invoice.go", true},
+		{"billing/*.sql", false},
+		{"voice.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchFileGlob(tt.glob, path); got != tt.want {
+			t.Errorf("matchFileGlob(%q) = %v, want %v", tt.glob, got, tt.want)
+		}
+	}
+	if matchFileGlob("*", "") {
+		t.Error("empty path should never match")
+	}
+}
+
+func TestThreadContext(t *testing.T) {
+	// 0 ─ 1 ─┬─ 2 (sidechain) ─ 3 (sidechain)
+	//        ├─ 4 (abandoned branch)
+	//        └─ 5 ─ 6
+	parents := []int{-1, 0, 1, 2, 1, 1, 5}
+	side := []bool{false, false, true, true, false, false, false}
+	var msgs []Message
+	for i, p := range parents {
+		msgs = append(msgs, Message{MsgIndex: i, Parent: p, Sidechain: side[i], Text: fmt.Sprint(i)})
+	}
+	th := newThread(msgs)
+
+	texts := func(ms []Message) string {
+		var s []string
+		for _, m := range ms {
+			s = append(s, m.Text)
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		name string
+		got  []Message
+		want string
+	}{
+		{"before main", th.before(6, 5), "0,1,5"},
+		{"before capped", th.before(6, 1), "5"},
+		{"before sidechain", th.before(3, 2), "1,2"},
+		{"after main skips sidechain and old branch", th.after(1, 3), "5,6"},
+		{"after sidechain stays on sidechain", th.after(2, 3), "3"},
+		{"after root", th.after(6, 2), ""},
+	}
+	for _, tt := range tests {
+		if got := texts(tt.got); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	opts := SearchOpts{Role: "both", Sidechain: "exclude"}
+	if opts.accepts(msgs[2]) || !opts.accepts(msgs[1]) {
+		t.Error("--sidechain exclude should drop only sidechain messages")
+	}
+	opts.Sidechain = "only"
+	if !opts.accepts(msgs[2]) || opts.accepts(msgs[1]) {
+		t.Error("--sidechain only should keep only sidechain messages")
+	}
+}
+
+func TestSearchOptsAcceptsEnvironment(t *testing.T) {
+	msg := Message{Type: "user", Kind: "text", GitBranch: "feat/payments", Cwd: "/home/me/src/api", Version: "1.0.80"}
+	tests := []struct {
+		name string
+		opts SearchOpts
+		want bool
+	}{
+		{"branch exact", SearchOpts{Branch: "feat/payments"}, true},
+		{"branch glob", SearchOpts{Branch: "feat/*"}, true},
+		{"branch other", SearchOpts{Branch: "main"}, false},
+		{"cwd trailing path", SearchOpts{Cwd: "src/api"}, true},
+		{"cwd prefix", SearchOpts{Cwd: "/home/me/src"}, true},
+		{"cwd glob", SearchOpts{Cwd: "*api"}, true},
+		{"cwd other", SearchOpts{Cwd: "/home/me/web"}, false},
+		{"version glob", SearchOpts{CCVersion: "1.0.*"}, true},
+		{"version other", SearchOpts{CCVersion: "2.*"}, false},
+	}
+	for _, tt := range tests {
+		tt.opts.Role = "both"
+		if got := tt.opts.accepts(msg); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOptsAcceptsModel(t *testing.T) {
+	answer := Message{Type: "assistant", Kind: "text", Model: "claude-opus-4-1-20250805"}
+	prompt := Message{Type: "user", Kind: "text"}
+	tests := []struct {
+		pattern string
+		msg     Message
+		want    bool
+	}{
+		{"opus", answer, true},
+		{"Opus", answer, true},
+		{"claude-opus-4*", answer, true},
+		{"claude-opus-4-1-20250805", answer, true},
+		{"sonnet", answer, false},
+		{"claude-*-4-5*", answer, false},
+		{"opus", prompt, false},
+	}
+	for _, tt := range tests {
+		opts := SearchOpts{Role: "both", Model: tt.pattern}
+		if got := opts.accepts(tt.msg); got != tt.want {
+			t.Errorf("--model %q on %s: got %v, want %v", tt.pattern, tt.msg.Type, got, tt.want)
+		}
+	}
+}
+
+func TestFindSessionFile(t *testing.T) {
+	base := t.TempDir()
+	for _, f := range []string{
+		"-a/3f2a9c10-0000-4000-8000-000000000001.jsonl",
+		"-a/3f2a9c10-0000-4000-8000-000000000001-extra.jsonl",
+		"-b/3f2b0000-0000-4000-8000-000000000002.jsonl",
+		"-b/77aa0000-0000-4000-8000-000000000003.jsonl",
+	} {
+		path := filepath.Join(base, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, nil, 0644)
+	}
+
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr string
+	}{
+		{"77", "-b/77aa0000-0000-4000-8000-000000000003.jsonl", ""},
+		{"3f2b", "-b/3f2b0000-0000-4000-8000-000000000002.jsonl", ""},
+		{"3f2a9c10-0000-4000-8000-000000000001", "-a/3f2a9c10-0000-4000-8000-000000000001.jsonl", ""},
+		{"3f2", "", "ambiguous"},
+		{"ffff", "", "no session"},
+	}
+	for _, tt := range tests {
+		got, err := findSessionFile(base, tt.prefix)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: got %q, %v; want error containing %q", tt.prefix, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != filepath.Join(base, tt.want) {
+			t.Errorf("%q: got %q, %v; want %q", tt.prefix, got, err, tt.want)
+		}
+	}
+}
+
+func TestSessionIDs(t *testing.T) {
+	fpath := "/home/me/.claude/projects/-src/3f2a9c10-0000-4000-8000-000000000001.jsonl"
+	if got := extractSessionID(fpath); got != "3f2a9c10-0000-4000-8000-000000000001" {
+		t.Errorf("extractSessionID = %q, want the full UUID", got)
+	}
+	if got := shortID(extractSessionID(fpath)); got != "3f2a9c10-000" {
+		t.Errorf("shortID = %q", got)
+	}
+
+	files, err := findSessionFiles(t.TempDir()+"/missing.jsonl", 7)
+	if err == nil {
+		t.Errorf("missing session file should fail, got %v", files)
+	}
+}
+
+func TestSearchOptsCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SearchOpts
+		pattern string
+		text    string
+		want    bool
+	}{
+		{"regex ignores case", SearchOpts{}, "foo.bar", "FOOxBAR", true},
+		{"case-sensitive", SearchOpts{CaseSensitive: true}, "Foo", "foo", false},
+		{"case-sensitive inline (?i)", SearchOpts{CaseSensitive: true}, "(?i)Foo", "foo", true},
+		{"fixed quotes metachars", SearchOpts{Fixed: true}, "Foo.Bar(", "call foo.bar(x)", true},
+		{"fixed dot is literal", SearchOpts{Fixed: true}, "Foo.Bar(", "FooxBar(", false},
+		{"word boundary", SearchOpts{Word: true}, "log", "the log file", true},
+		{"word inside word", SearchOpts{Word: true}, "log", "catalog", false},
+		{"word alternation", SearchOpts{Word: true}, "cat|dog", "hotdog", false},
+		{"all modes", SearchOpts{Fixed: true, Word: true, CaseSensitive: true}, "a.b", "x a.b y", true},
+	}
+	for _, tt := range tests {
+		re, err := tt.opts.compile(tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := re.MatchString(tt.text); got != tt.want {
+			t.Errorf("%s: match %q = %v, want %v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchOptsPrefilterLiterals(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SearchOpts
+		pattern string
+		want    []string
+		exact   bool
+	}{
+		{"regex folds", SearchOpts{}, "Deploy.*Config", []string{"deploy"}, false},
+		{"case-sensitive keeps case", SearchOpts{CaseSensitive: true}, "Deploy.*Config", []string{"Deploy"}, true},
+		{"inline (?i) folds", SearchOpts{CaseSensitive: true}, "(?i)Deploy", []string{"deploy"}, false},
+		{"fixed is one literal", SearchOpts{Fixed: true}, "Foo.Bar(", []string{"foo.bar("}, false},
+		{"fixed case-sensitive", SearchOpts{Fixed: true, CaseSensitive: true}, "Foo.Bar(", []string{"Foo.Bar("}, true},
+		{"fixed (?i) is literal", SearchOpts{Fixed: true, CaseSensitive: true}, "(?i)X", []string{"(?i)X"}, true},
+		{"empty fixed", SearchOpts{Fixed: true}, "", nil, false},
+		// Quotes and backslashes are escaped in the raw JSONL
+		{"fixed quotes", SearchOpts{Fixed: true}, `fmt.Println("hello")`, []string{"fmt.println("}, false},
+		{"fixed backslash", SearchOpts{Fixed: true}, `C:\Users\deploy`, []string{"deploy"}, false},
+		{"fixed only escapes", SearchOpts{Fixed: true}, `"\"`, nil, false},
+		{"regex escaped quote", SearchOpts{}, `say \"hi there\"`, []string{"hi there"}, false},
+	}
+	for _, tt := range tests {
+		got := tt.opts.prefilterLiterals(tt.pattern)
+		var strs []string
+		for _, lit := range got {
+			strs = append(strs, string(lit))
+		}
+		if fmt.Sprint(strs) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, strs, tt.want)
+		}
+		if exact := tt.opts.exactCase(tt.pattern); exact != tt.exact {
+			t.Errorf("%s: exactCase = %v, want %v", tt.name, exact, tt.exact)
+		}
+	}
+}
+
+func TestFixedSearchEscapedText(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "aaaa.jsonl"), []byte(`{"type":"user","timestamp":"2025-01-01T12:00:00Z","message":{"content":"add fmt.Println(\"hello\") to C:\\src\\main.go"}}`+"\n"), 0644)
+
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10, Fixed: true}
+	for _, lit := range []string{`fmt.Println("hello")`, `C:\src\main.go`} {
+		matches, _, err := regexSearch(lit, dir, opts)
+		if err != nil || len(matches) != 1 {
+			t.Errorf("-F %s: got %d matches, err %v", lit, len(matches), err)
+		}
+	}
+}
+
+func TestHasUpper(t *testing.T) {
+	tests := []struct {
+		pattern string
+		fixed   bool
+		want    bool
+	}{
+		{"deploy", false, false},
+		{"Deploy", false, true},
+		{`\S+\W`, false, false},
+		{`\S+Fix`, false, true},
+		{`\S`, true, true},
+		{"über", false, false},
+		{"Über", false, true},
+	}
+	for _, tt := range tests {
+		if got := hasUpper(tt.pattern, tt.fixed); got != tt.want {
+			t.Errorf("hasUpper(%q, %v) = %v, want %v", tt.pattern, tt.fixed, got, tt.want)
+		}
+	}
+}
+
+func TestMultiSearch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	sessions := map[string]string{
+		"aaaa": `{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"OOMKilled again"}}
+{"type":"user","uuid":"u2","parentUuid":"u1","timestamp":"2025-01-02T10:01:00Z","message":{"content":"disk full and oomkilled"}}
+`,
+		"bbbb": `{"type":"user","uuid":"u1","timestamp":"2025-01-03T10:00:00Z","message":{"content":"all quiet"}}
+`,
+	}
+	for name, data := range sessions {
+		os.WriteFile(filepath.Join(dir, name+".jsonl"), []byte(data), 0644)
+	}
+
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+	matches, stats, err := multiSearch([]string{"oomkilled", "disk full"}, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PrefilterSkipped != 1 {
+		t.Errorf("one OR prefilter should skip the quiet session, skipped %d", stats.PrefilterSkipped)
+	}
+	want := []string{"oomkilled, disk full", "oomkilled"} // newest first
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for i, m := range matches {
+		if m.Term != want[i] {
+			t.Errorf("[%d] %q: term %q, want %q", i, m.Message.Text, m.Term, want[i])
+		}
+	}
+
+	// A single pattern needs no label
+	matches, _, _ = regexSearch("oomkilled", dir, opts)
+	if len(matches) != 2 || matches[0].Term != "" {
+		t.Errorf("single pattern: got %+v", matches)
+	}
+
+	// A pattern without literals disables the prefilter
+	_, stats, _ = multiSearch([]string{"oomkilled", ".+"}, dir, opts)
+	if stats.PrefilterSkipped != 0 {
+		t.Errorf("prefilter skipped %d files for a literal-free pattern", stats.PrefilterSkipped)
+	}
+}
+
+func TestWithoutAndInvertSearch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	sessions := map[string]string{
+		"aaaa": `{"type":"user","uuid":"u1","timestamp":"2025-01-02T10:00:00Z","message":{"content":"deploy the api"}}
+`,
+		"bbbb": `{"type":"user","uuid":"u1","timestamp":"2025-01-03T10:00:00Z","message":{"content":"deploy failed"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","timestamp":"2025-01-03T10:01:00Z","message":{"content":[{"type":"text","text":"Rolled back: rollback done."}]}}
+`,
+		"cccc": `{"type":"user","uuid":"u1","timestamp":"2025-01-04T10:00:00Z","message":{"content":"write docs"}}
+`,
+	}
+	for name, data := range sessions {
+		os.WriteFile(filepath.Join(dir, name+".jsonl"), []byte(data), 0644)
+	}
+
+	// --without checks every message, even those the filters hide
+	opts := SearchOpts{Role: "user", MaxDays: 3650, MaxResults: 10, Without: "rollback"}
+	matches, _, err := regexSearch("deploy", dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Message.SessionID != "aaaa" {
+		t.Errorf("--without: got %+v", matches)
+	}
+
+	opts.Without = ""
+	found, stats, err := invertSearch([]string{"deploy"}, dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Message.SessionID != "cccc" || found[0].Message.Timestamp == "" {
+		t.Errorf("-L: got %+v", found)
+	}
+	if stats.PrefilterSkipped != 1 {
+		t.Errorf("-L: prefilter skipped %d, want 1", stats.PrefilterSkipped)
+	}
+}
+
+func TestSearchOptsWindow(t *testing.T) {
+	ts := func(age time.Duration) string {
+		return time.Now().Add(-age).UTC().Format("2006-01-02T15:04:05")
+	}
+	recent := Message{Type: "user", Timestamp: ts(time.Hour)}
+	old := Message{Type: "user", Timestamp: ts(30 * 24 * time.Hour)}
+	undated := Message{Type: "user"}
+
+	tests := []struct {
+		name                 string
+		opts                 SearchOpts
+		recent, old, undated bool
+	}{
+		{"-d 7", SearchOpts{MaxDays: 7}, true, false, true},
+		{"-H 4", SearchOpts{MaxDays: 7, MaxAge: 4 * time.Hour}, true, false, true},
+		{"-H 4 misses 5h", SearchOpts{MaxAge: 30 * time.Minute}, false, false, true},
+		{"--follow-continuations", SearchOpts{MaxDays: 7, FollowContinuations: true}, true, true, true},
+		{"--since", SearchOpts{MaxDays: 1, Since: time.Now().AddDate(0, 0, -60)}, true, true, false},
+		{"--until", SearchOpts{Until: time.Now().AddDate(0, 0, -1)}, false, true, false},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			msg  Message
+			want bool
+		}{{recent, tt.recent}, {old, tt.old}, {undated, tt.undated}} {
+			if got := tt.opts.accepts(c.msg); got != c.want {
+				t.Errorf("%s: accepts(%q) = %v, want %v", tt.name, c.msg.Timestamp, got, c.want)
+			}
+		}
+	}
+}
+
+func TestDescribeWindow(t *testing.T) {
+	sep := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		opts SearchOpts
+		want string
+	}{
+		{SearchOpts{MaxDays: 7}, "last 7 days"},
+		{SearchOpts{MaxDays: 7, MaxAge: 4 * time.Hour}, "last 4 hours"},
+		{SearchOpts{MaxDays: 9, MaxAge: 200 * time.Hour, Since: sep}, "since 2026-09-01"},
+		{SearchOpts{Since: sep, Until: sep.AddDate(0, 1, 0)}, "2026-09-01 to 2026-10-01"},
+		{SearchOpts{Until: sep.Add(90 * time.Minute)}, "before 2026-09-01 01:30"},
+		{SearchOpts{MaxDays: 30, Until: sep}, "last 30 days, before 2026-09-01"},
+		{SearchOpts{}, "any time"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.describeWindow(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestUntilAlone(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	fp := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"user","uuid":"u1","timestamp":"2025-06-01T10:00:00Z","message":{"content":"deploy the api"}}
+`), 0644)
+	old := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	os.Chtimes(fp, old, old)
+	until := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+
+	// --until with the default -d 7 searches everything before it
+	opts := SearchOpts{Role: "both", MaxDays: 7, MaxResults: 10, Until: until}
+	opts.resolveWindow(false)
+	matches, _, err := regexSearch("deploy", dir, opts)
+	if err != nil || len(matches) != 1 {
+		t.Errorf("--until alone: got %d matches, err %v", len(matches), err)
+	}
+	if got := opts.describeWindow(); got != "before 2026-01-01" {
+		t.Errorf("describeWindow: %q", got)
+	}
+
+	// An explicit -d still applies
+	opts = SearchOpts{Role: "both", MaxDays: 7, MaxResults: 10, Until: until}
+	opts.resolveWindow(true)
+	if matches, _, _ := regexSearch("deploy", dir, opts); len(matches) != 0 {
+		t.Errorf("--until -d 7: got %d matches, want 0", len(matches))
+	}
+	if got := opts.describeWindow(); got != "last 7 days, before 2026-01-01" {
+		t.Errorf("describeWindow: %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
@@ -17,27 +18,93 @@ type IndexEntry struct {
 	Preview   string // first 200 chars of text
 	FilePath  string
 	Vector    []float32
+	Kind      string // message kind, see Message.Kind (empty in older indexes)
+	Tool      string
+	Target    string // file path for file tool calls
+	Sidechain bool   // subagent (Task) message
+	Cwd       string
+	GitBranch string
+	Version   string // Claude Code version
+	Model     string // model that produced an assistant message
+	UUID      string // line uuid, with Block the message's identity in its file
+	Block     int
+}
+
+// newIndexEntry records a message for an index, with a preview of its
+// text in place of the full text.
+func newIndexEntry(msg Message) IndexEntry {
+	preview := msg.Text
+	if len(preview) > previewLen {
+		preview = preview[:previewLen]
+	}
+	return IndexEntry{
+		SessionID: msg.SessionID,
+		MsgIndex:  msg.MsgIndex,
+		Role:      msg.Role,
+		Timestamp: msg.Timestamp,
+		Preview:   preview,
+		FilePath:  msg.FilePath,
+		Kind:      msg.Kind,
+		Tool:      msg.Tool,
+		Target:    msg.Target,
+		Sidechain: msg.Sidechain,
+		Cwd:       msg.Cwd,
+		GitBranch: msg.GitBranch,
+		Version:   msg.Version,
+		Model:     msg.Model,
+		UUID:      msg.UUID,
+		Block:     msg.Block,
+	}
 }
 
 // FileMetadata tracks which files have been indexed.
 type FileMetadata struct {
 	FilePath     string
 	LastModified time.Time
+	Title        string // session title from its summary lines
+	NoUUIDs      bool   // some messages have no uuid; their entries go by position
 }
 
+// indexFormat is the vector index layout; --index rebuilds projects
+// indexed in an older one, and semantic search skips them until then.
+// 1: tool_use blocks are messages of their own, and entries record cwd,
+// branch, version and model.
+const indexFormat = 1
+
 // Index is the in-memory representation of a project's vector index.
 type Index struct {
 	Entries  []IndexEntry
 	Files    map[string]FileMetadata // keyed by filepath
 	Project  string
+	Embedder EmbedderID // model the vectors came from; empty in older indexes
+	Dims     int
+	Format   int // indexFormat when built; 0 before it was recorded
+}
+
+// embeddedWith returns the model an index's vectors came from. Indexes
+// from before the embedder was recorded were always built by ollama with
+// nomic-embed-text.
+func (idx *Index) embeddedWith() EmbedderID {
+	if idx.Embedder.Backend == "" {
+		return EmbedderID{"ollama", embedModel}
+	}
+	return idx.Embedder
 }
 
 // IndexStats holds aggregate index statistics.
 type IndexStats struct {
 	Projects     int
+	Embedders    []string // models the project indexes were built with
+	Outdated     int      // project indexes in an older indexFormat
 	Files        int
 	Vectors      int
 	SizeBytes    int64
+	TrigramFiles int   // session files in the trigram index
+	TrigramBytes int64 // size of the trigram index on disk
+
+	KeywordFiles    int // session files in the keyword index
+	KeywordMessages int
+	KeywordBytes    int64
 }
 
 func indexDir() string {
@@ -45,6 +112,13 @@ func indexDir() string {
 	return filepath.Join(home, ".claude", "search-index")
 }
 
+// hasVectorIndex reports whether any project has been indexed for
+// semantic search.
+func hasVectorIndex() bool {
+	shards, _ := filepath.Glob(filepath.Join(indexDir(), "*.gob"))
+	return len(shards) > 0
+}
+
 func indexPath(project string) string {
 	return filepath.Join(indexDir(), project+".gob")
 }
@@ -108,6 +182,40 @@ func getIndexStats() IndexStats {
 		idx := loadIndex(project)
 		stats.Files += len(idx.Files)
 		stats.Vectors += len(idx.Entries)
+		if len(idx.Entries) > 0 && idx.Format < indexFormat {
+			stats.Outdated++
+		}
+		if len(idx.Entries) > 0 {
+			if id := idx.embeddedWith().String(); !slices.Contains(stats.Embedders, id) {
+				stats.Embedders = append(stats.Embedders, id)
+			}
+		}
+	}
+
+	shards, _ := os.ReadDir(trigramDir())
+	for _, e := range shards {
+		if filepath.Ext(e.Name()) != ".gob" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			stats.TrigramBytes += info.Size()
+		}
+		stats.TrigramFiles += len(loadTrigramIndex(e.Name()[:len(e.Name())-4]).Files)
+	}
+
+	shards, _ = os.ReadDir(keywordDir())
+	for _, e := range shards {
+		if filepath.Ext(e.Name()) != ".gob" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			stats.KeywordBytes += info.Size()
+		}
+		idx := loadKeywordIndex(e.Name()[:len(e.Name())-4])
+		stats.KeywordFiles += len(idx.Files)
+		for _, kf := range idx.Files {
+			stats.KeywordMessages += len(kf.Entries)
+		}
 	}
 
 	return stats
@@ -27,6 +27,7 @@ type UsageEvent struct {
 	DurationMs     int64  `json:"ms"`
 	PrefilterSkip  int    `json:"pf_skip,omitempty"`
 	RegexSearched  int    `json:"pf_pass,omitempty"`
+	IndexSkip      int    `json:"ix_skip,omitempty"` // of pf_skip, ruled out by the trigram index
 }
 
 func usageLogPath() string {
@@ -151,6 +152,17 @@ func printUsageStats() {
 		}
 	}
 
+	// Trigram index: how much of the prefilter's work it did unopened
+	var pfSkipped, ixSkipped int
+	for _, ev := range recent {
+		pfSkipped += ev.PrefilterSkip
+		ixSkipped += ev.IndexSkip
+	}
+	if ixSkipped > 0 {
+		fmt.Println()
+		fmt.Printf("Trigram index: %d of %d prefilter skips (%d%%) without opening the file\n", ixSkipped, pfSkipped, ixSkipped*100/pfSkipped)
+	}
+
 	// Prefilter diagnostics: detect searches where prefilter killed all files
 	var pfFalseNeg []string
 	for _, ev := range recent {
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The trigram index records, for each session file, which byte trigrams
+// its case-folded contents contain. A search turns its prefilter literals
+// into a trigram query and skips files that can't contain them, without
+// opening them. The index only ever rules files out: files it doesn't
+// know, or that changed since --index, are scanned as before.
+//
+// Each file's trigrams are kept in a bloom filter (about 10 bits per
+// distinct trigram, ~1% false positives per trigram), so a shard stays a
+// few percent of the size of the sessions it covers.
+
+const (
+	bloomBitsPerTrigram = 10
+	bloomHashes         = 4
+	minBloomBits        = 1 << 10
+)
+
+// TrigramFile is the trigram summary of one session file.
+type TrigramFile struct {
+	Size    int64
+	ModTime time.Time
+	Bloom   []uint64 // bloom filter; its length in bits is a power of two
+}
+
+// TrigramIndex is one project's shard of the trigram index.
+type TrigramIndex struct {
+	Project string
+	Files   map[string]TrigramFile // keyed by filepath
+}
+
+func trigramDir() string {
+	return filepath.Join(indexDir(), "trigram")
+}
+
+func trigramPath(project string) string {
+	return filepath.Join(trigramDir(), project+".gob")
+}
+
+// indexProject names the index shard a session file belongs to: its project
+// directory under ~/.claude/projects, however deep the file sits in it.
+func indexProject(fpath string) string {
+	sep := string(filepath.Separator)
+	marker := sep + filepath.Join(".claude", "projects") + sep
+	if i := strings.LastIndex(fpath, marker); i >= 0 {
+		rest := fpath[i+len(marker):]
+		if j := strings.Index(rest, sep); j >= 0 {
+			return rest[:j]
+		}
+	}
+	return extractProject(fpath)
+}
+
+func loadTrigramIndex(project string) *TrigramIndex {
+	idx := &TrigramIndex{Project: project, Files: make(map[string]TrigramFile)}
+	f, err := os.Open(trigramPath(project))
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		return &TrigramIndex{Project: project, Files: make(map[string]TrigramFile)}
+	}
+	return idx
+}
+
+func saveTrigramIndex(idx *TrigramIndex) error {
+	if err := os.MkdirAll(trigramDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(trigramPath(idx.Project))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(idx)
+}
+
+// updateTrigramIndex brings a project's shard up to date with its session
+// files, re-reading only those whose size or modification time changed.
+// It returns how many files were indexed and how many were unchanged.
+func updateTrigramIndex(project string, files []string, reindexAll bool) (indexed, unchanged int, err error) {
+	idx := loadTrigramIndex(project)
+	if reindexAll {
+		idx.Files = make(map[string]TrigramFile)
+	}
+
+	present := make(map[string]bool, len(files))
+	for _, fpath := range files {
+		present[fpath] = true
+		info, err := os.Stat(fpath)
+		if err != nil {
+			continue
+		}
+		if tf, ok := idx.Files[fpath]; ok && tf.Size == info.Size() && tf.ModTime.Equal(info.ModTime()) {
+			unchanged++
+			continue
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			continue
+		}
+		bloom, err := trigramBloom(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		idx.Files[fpath] = TrigramFile{Size: info.Size(), ModTime: info.ModTime(), Bloom: bloom}
+		indexed++
+	}
+	// Forget deleted sessions
+	for fpath := range idx.Files {
+		if !present[fpath] {
+			delete(idx.Files, fpath)
+		}
+	}
+	return indexed, unchanged, saveTrigramIndex(idx)
+}
+
+// trigramBloom reads a stream and returns a bloom filter of its
+// case-folded byte trigrams, folded the way the prefilter folds them.
+func trigramBloom(r io.Reader) ([]uint64, error) {
+	set := make(map[uint32]struct{})
+	var prev uint32 // the last two bytes seen, in the low 16 bits
+	seen := 0       // bytes seen, up to 2
+	var partial, lower []byte
+	buf := make([]byte, lineBufSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			p := append(partial, buf[:n]...)
+			partial = nil
+			if cut := incompleteRuneStart(p); cut < len(p) {
+				partial = append([]byte(nil), p[cut:]...)
+				p = p[:cut]
+			}
+			lower = appendLower(lower[:0], p)
+			for _, c := range lower {
+				prev = prev<<8 | uint32(c)
+				if seen < 2 {
+					seen++
+					continue
+				}
+				set[prev&0xffffff] = struct{}{}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := max(uint(len(set))*bloomBitsPerTrigram, minBloomBits)
+	m = 1 << bits.Len(m-1) // round up to a power of two
+	bloom := make([]uint64, m/64)
+	for t := range set {
+		bloomAdd(bloom, t)
+	}
+	return bloom, nil
+}
+
+// bloomHash derives the two hashes of a trigram for double hashing.
+func bloomHash(t uint32) (uint64, uint64) {
+	x := mix64(uint64(t))
+	return x, x>>32 | 1
+}
+
+func bloomAdd(bloom []uint64, t uint32) {
+	mask := uint64(len(bloom)*64 - 1)
+	h1, h2 := bloomHash(t)
+	for i := uint64(0); i < bloomHashes; i++ {
+		b := (h1 + i*h2) & mask
+		bloom[b/64] |= 1 << (b % 64)
+	}
+}
+
+func bloomHas(bloom []uint64, t uint32) bool {
+	mask := uint64(len(bloom)*64 - 1)
+	h1, h2 := bloomHash(t)
+	for i := uint64(0); i < bloomHashes; i++ {
+		b := (h1 + i*h2) & mask
+		if bloom[b/64]&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trigramQuery is a prefilter turned into trigrams: an AND of groups,
+// each an OR of literals, each an AND of the literal's trigrams.
+type trigramQuery [][][]uint32
+
+// newTrigramQuery builds the query for prefilter groups (see
+// prefilterAllReader). A group with a literal shorter than three bytes
+// could match any file and is left out; nil means nothing is indexable
+// and every file must be scanned.
+func newTrigramQuery(groups [][][]byte) trigramQuery {
+	var q trigramQuery
+	for _, g := range groups {
+		var alts [][]uint32
+		for _, lit := range g {
+			l := []byte(strings.ToLower(string(lit)))
+			if len(l) < 3 {
+				alts = nil
+				break
+			}
+			var tris []uint32
+			for i := 0; i+3 <= len(l); i++ {
+				tris = append(tris, uint32(l[i])<<16|uint32(l[i+1])<<8|uint32(l[i+2]))
+			}
+			alts = append(alts, tris)
+		}
+		if len(alts) > 0 {
+			q = append(q, alts)
+		}
+	}
+	return q
+}
+
+// mayMatch reports whether a file with this bloom filter could satisfy q.
+func (q trigramQuery) mayMatch(bloom []uint64) bool {
+	if len(bloom) == 0 {
+		return true
+	}
+	for _, alts := range q {
+		found := false
+		for _, tris := range alts {
+			all := true
+			for _, t := range tris {
+				if !bloomHas(bloom, t) {
+					all = false
+					break
+				}
+			}
+			if all {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// trigramFilter splits session files into those that may contain the
+// prefilter groups and those the trigram index rules out. Files missing
+// from the index or changed since it was built are always candidates.
+func trigramFilter(files []string, groups [][][]byte) (candidates, ruledOut []string) {
+	q := newTrigramQuery(groups)
+	if len(q) == 0 {
+		return files, nil
+	}
+	shards := make(map[string]*TrigramIndex)
+	for _, fpath := range files {
+		project := indexProject(fpath)
+		idx, ok := shards[project]
+		if !ok {
+			idx = loadTrigramIndex(project)
+			shards[project] = idx
+		}
+		tf, ok := idx.Files[fpath]
+		if ok && !q.mayMatch(tf.Bloom) {
+			if info, err := os.Stat(fpath); err == nil && tf.Size == info.Size() && tf.ModTime.Equal(info.ModTime()) {
+				ruledOut = append(ruledOut, fpath)
+				continue
+			}
+		}
+		candidates = append(candidates, fpath)
+	}
+	return candidates, ruledOut
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestTrigramQuery(t *testing.T) {
+	bloom, err := trigramBloom(strings.NewReader(`{"message":{"content":"Deploy the Invoice service"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		groups [][][]byte
+		want   bool
+	}{
+		{"present", [][][]byte{{[]byte("invoice")}}, true},
+		{"folded", [][][]byte{{[]byte("DEPLOY")}}, true},
+		{"absent", [][][]byte{{[]byte("rollback")}}, false},
+		{"one of an OR", [][][]byte{{[]byte("rollback"), []byte("service")}}, true},
+		{"AND with an absent group", [][][]byte{{[]byte("deploy")}, {[]byte("rollback")}}, false},
+		{"short literal matches anything", [][][]byte{{[]byte("zq"), []byte("rollback")}}, true},
+	}
+	for _, tt := range tests {
+		q := newTrigramQuery(tt.groups)
+		if got := len(q) == 0 || q.mayMatch(bloom); got != tt.want {
+			t.Errorf("%s: may match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrigramBloomChunks(t *testing.T) {
+	// Trigrams spanning reads, including a split multibyte rune, must
+	// still be recorded
+	text := strings.Repeat("x", lineBufSize-2) + "ÉCLAIR rollback"
+	bloom, err := trigramBloom(iotest.HalfReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lit := range []string{"xéc", "éclair", "rollback"} {
+		if !newTrigramQuery([][][]byte{{[]byte(lit)}}).mayMatch(bloom) {
+			t.Errorf("%q not found across chunk boundaries", lit)
+		}
+	}
+}
+
+func TestTrigramFilter(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	write := func(name, text string) string {
+		fp := filepath.Join(dir, name+".jsonl")
+		os.WriteFile(fp, []byte(`{"type":"user","message":{"content":"`+text+`"}}`+"\n"), 0644)
+		return fp
+	}
+	deploy := write("aaaa", "deploy the api")
+	docs := write("bbbb", "write docs")
+
+	if n, _, err := updateTrigramIndex("proj", []string{deploy, docs}, false); err != nil || n != 2 {
+		t.Fatalf("indexed %d files, err %v", n, err)
+	}
+	if n, unchanged, _ := updateTrigramIndex("proj", []string{deploy, docs}, false); n != 0 || unchanged != 2 {
+		t.Errorf("second update indexed %d, unchanged %d", n, unchanged)
+	}
+
+	groups := [][][]byte{{[]byte("deploy")}}
+	candidates, ruledOut := trigramFilter([]string{deploy, docs}, groups)
+	if len(candidates) != 1 || candidates[0] != deploy || len(ruledOut) != 1 {
+		t.Errorf("got candidates %v, ruled out %v", candidates, ruledOut)
+	}
+
+	// Files changed since --index and files it never saw are scanned
+	os.WriteFile(docs, []byte(`{"type":"user","message":{"content":"deploy docs"}}`+"\n"), 0644)
+	os.Chtimes(docs, time.Now(), time.Now().Add(time.Minute))
+	unknown := write("cccc", "nothing here")
+	candidates, ruledOut = trigramFilter([]string{deploy, docs, unknown}, groups)
+	if len(candidates) != 3 || len(ruledOut) != 0 {
+		t.Errorf("stale index: got candidates %v, ruled out %v", candidates, ruledOut)
+	}
+
+	// Unindexable patterns scan everything
+	candidates, _ = trigramFilter([]string{deploy, docs}, nil)
+	if len(candidates) != 2 {
+		t.Errorf("no literals: got %d candidates", len(candidates))
+	}
+
+	// Searches count index hits as prefilter skips
+	os.WriteFile(docs, []byte(`{"type":"user","message":{"content":"write docs"}}`+"\n"), 0644)
+	updateTrigramIndex("proj", []string{deploy, docs, unknown}, false)
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+	_, stats, err := regexSearch("deploy", dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.IndexSkipped != 2 || stats.PrefilterSkipped != 2 || stats.RegexSearched != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+	found, _, _ := invertSearch([]string{"deploy"}, dir, opts)
+	if len(found) != 2 {
+		t.Errorf("-L should list the sessions the index ruled out, got %d", len(found))
+	}
+}
+
+func TestTrigramFilterRegexEscapes(t *testing.T) {
+	// \s and \d are classes, not letters: the index must not rule out
+	// files for an "oks" or "d" that the pattern never asked for
+	t.Setenv("HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "proj")
+	os.MkdirAll(dir, 0755)
+	fp := filepath.Join(dir, "aaaa.jsonl")
+	os.WriteFile(fp, []byte(`{"type":"user","message":{"content":"ok  \tgithub.com/x/api 0.4s\nFAIL  3 tests"}}`+"\n"), 0644)
+	updateTrigramIndex("proj", []string{fp}, false)
+
+	opts := SearchOpts{Role: "both", MaxDays: 3650, MaxResults: 10}
+	for _, pattern := range []string{`ok\s`, `FAIL\s+\d tests`, `api \d\.\ds`} {
+		matches, stats, err := regexSearch(pattern, dir, opts)
+		if err != nil || len(matches) != 1 || stats.IndexSkipped != 0 {
+			t.Errorf("%q: got %d matches, %d ruled out by the index, err %v", pattern, len(matches), stats.IndexSkipped, err)
+		}
+	}
+}
+
+func TestIndexProject(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/home/u/.claude/projects/-src-api/aaaa.jsonl", "-src-api"},
+		{"/home/u/.claude/projects/-src-api/aaaa/subagents/agent-1.jsonl", "-src-api"},
+		{"/tmp/proj/aaaa.jsonl", "proj"},
+	}
+	for _, tt := range tests {
+		if got := indexProject(filepath.FromSlash(tt.path)); got != tt.want {
+			t.Errorf("indexProject(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -7,21 +7,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"time"
 )
 
 func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error) {
-	// Check ollama
-	if !ollamaReachable() {
-		return nil, fmt.Errorf("ollama not running — start with: ollama serve")
-	}
-
-	// Embed the query
-	queryVec, err := embed(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to embed query: %w", err)
-	}
-
 	// Load relevant indexes
 	dir := indexDir()
 	entries, err := os.ReadDir(dir)
@@ -34,25 +22,15 @@ func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error)
 	projectsBase := filepath.Join(home, ".claude", "projects")
 	searchAll := searchPath == projectsBase
 
-	// Time filter
-	var cutoff time.Time
-	if opts.MaxDays > 0 {
-		cutoff = time.Now().AddDate(0, 0, -opts.MaxDays)
-	}
-
 	type scored struct {
 		entry      IndexEntry
 		similarity float32
+		title      string
 	}
 
-	var candidates []scored
-
-	// Find the current session file to exclude
-	var excludeFile string
-	if opts.ExcludeSelf {
-		excludeFile = findNewestSessionFile(searchPath)
-	}
-
+	var indexes []*Index
+	var outdated int
+	indexed := make(map[EmbedderID]bool)
 	for _, e := range entries {
 		if filepath.Ext(e.Name()) != ".gob" {
 			continue
@@ -60,7 +38,11 @@ func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error)
 		project := e.Name()[:len(e.Name())-4]
 
 		// Filter by project if not searching all
-		if !searchAll {
+		if isSessionFile(searchPath) {
+			if project != extractProject(searchPath) {
+				continue
+			}
+		} else if !searchAll {
 			projectDir := filepath.Join(projectsBase, project)
 			if !strings.HasPrefix(projectDir, searchPath) && projectDir != searchPath {
 				continue
@@ -71,32 +53,73 @@ func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error)
 		if len(idx.Entries) == 0 {
 			continue
 		}
+		// Entries from an older format may point at the wrong message
+		if idx.Format < indexFormat {
+			outdated++
+			continue
+		}
+		indexes = append(indexes, idx)
+		indexed[idx.embeddedWith()] = true
+	}
+	if outdated > 0 {
+		if len(indexes) == 0 {
+			return nil, fmt.Errorf("index is in an old format — run: claude-grep --index")
+		}
+		fmt.Fprintf(os.Stderr, "warning: skipped %d project(s) in an old index format — run: claude-grep --index\n", outdated)
+	}
+
+	// Embed the query with a model the indexes were built with
+	embedder, err := searchEmbedder(indexed)
+	if err != nil {
+		return nil, err
+	}
+	queryVec, err := embedder.Embed(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	model := embedder.ID()
+
+	var candidates []scored
+	var searched int
+	var otherModel EmbedderID // of a project index that was skipped
+
+	// Find the current session file to exclude
+	var excludeFile string
+	if opts.ExcludeSelf {
+		excludeFile = findNewestSessionFile(searchPath)
+	}
+
+	for _, idx := range indexes {
+		// Only vectors from the query's model are comparable
+		if idx.embeddedWith() != model || (idx.Dims != 0 && idx.Dims != len(queryVec)) {
+			otherModel = idx.embeddedWith()
+			continue
+		}
+		searched++
 
 		for _, entry := range idx.Entries {
-			// Skip current session
+			// Skip current session, or every other one with --session
 			if excludeFile != "" && entry.FilePath == excludeFile {
 				continue
 			}
-			// Role filter
-			if opts.Role != "both" && entry.Role != opts.Role {
+			if isSessionFile(searchPath) && entry.FilePath != searchPath {
 				continue
 			}
-
-			// Time filter
-			if !cutoff.IsZero() && entry.Timestamp != "" {
-				t, err := time.Parse("2006-01-02T15:04:05", entry.Timestamp)
-				if err == nil && t.Before(cutoff) {
-					continue
-				}
+			// Role, tool and time filters
+			if !opts.accepts(entry.message()) {
+				continue
 			}
 
 			sim := cosineSimilarity(queryVec, entry.Vector)
-			if sim > 0.55 { // minimum threshold (0.3 was too low — nomic-embed-text baseline is high)
-				candidates = append(candidates, scored{entry: entry, similarity: sim})
+			if sim > embedder.Threshold() {
+				candidates = append(candidates, scored{entry: entry, similarity: sim, title: idx.Files[entry.FilePath].Title})
 			}
 		}
 	}
 
+	if searched == 0 && otherModel.Backend != "" {
+		return nil, fmt.Errorf("index built with %s, not %s — run: claude-grep --index", otherModel, model)
+	}
 	if len(candidates) == 0 {
 		return nil, nil
 	}
@@ -118,53 +141,20 @@ func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error)
 	// Convert to matches, with lazy context retrieval
 	var matches []Match
 	for _, c := range candidates {
-		msg := Message{
-			Role:      c.entry.Role,
-			Type:      c.entry.Role,
-			Text:      c.entry.Preview,
-			Timestamp: c.entry.Timestamp,
-			SessionID: c.entry.SessionID,
-			Project:   extractProject(c.entry.FilePath),
-			FilePath:  c.entry.FilePath,
-			MsgIndex:  c.entry.MsgIndex,
-		}
-
 		m := Match{
-			Message:    msg,
+			Message:    c.entry.message(),
 			Similarity: c.similarity,
 		}
+		m.Message.Title = c.title
 
 		// Only re-read file if context requested or preview is empty
 		if (opts.Before > 0 || opts.After > 0) || c.entry.Preview == "" {
-			if data, err := os.ReadFile(c.entry.FilePath); err == nil {
-				allMsgs := parseJSONL(c.entry.FilePath, data)
-				// Find matching message by index
-				if c.entry.MsgIndex < len(allMsgs) {
-					m.Message.Text = allMsgs[c.entry.MsgIndex].Text
-				}
-
-				// Context before
-				if opts.Before > 0 {
-					start := c.entry.MsgIndex - opts.Before
-					if start < 0 {
-						start = 0
-					}
-					for j := start; j < c.entry.MsgIndex; j++ {
-						if j < len(allMsgs) {
-							m.ContextBefore = append(m.ContextBefore, allMsgs[j])
-						}
-					}
-				}
-
-				// Context after
-				if opts.After > 0 {
-					end := c.entry.MsgIndex + opts.After + 1
-					if end > len(allMsgs) {
-						end = len(allMsgs)
-					}
-					for j := c.entry.MsgIndex + 1; j < end; j++ {
-						m.ContextAfter = append(m.ContextAfter, allMsgs[j])
-					}
+			if allMsgs, err := parseJSONLFile(c.entry.FilePath); err == nil {
+				if i := findEntryMessage(allMsgs, c.entry); i >= 0 {
+					m.Message.Text = allMsgs[i].Text
+					t := newThread(allMsgs)
+					m.ContextBefore = t.before(i, opts.Before)
+					m.ContextAfter = t.after(i, opts.After)
 				}
 			}
 		}
@@ -175,6 +165,53 @@ func semanticSearch(query, searchPath string, opts SearchOpts) ([]Match, error)
 	return matches, nil
 }
 
+// findEntryMessage locates an index entry's message in a freshly parsed
+// file: by uuid when the entry has one, else by its recorded MsgIndex.
+// Returns -1 if the message is gone.
+func findEntryMessage(msgs []Message, e IndexEntry) int {
+	if e.UUID != "" {
+		for i, m := range msgs {
+			if m.UUID == e.UUID && m.Block == e.Block {
+				return i
+			}
+		}
+		return -1
+	}
+	if e.MsgIndex < len(msgs) {
+		return e.MsgIndex
+	}
+	return -1
+}
+
+// message converts an index entry to a Message using its preview as text.
+func (e IndexEntry) message() Message {
+	kind := e.Kind
+	if kind == "" {
+		kind = "text"
+	}
+	return Message{
+		Role:      e.Role,
+		Type:      e.Role,
+		Text:      e.Preview,
+		Timestamp: e.Timestamp,
+		SessionID: extractSessionID(e.FilePath), // older indexes stored a 12-char prefix
+		Project:   extractProject(e.FilePath),
+		FilePath:  e.FilePath,
+		MsgIndex:  e.MsgIndex,
+		Kind:      kind,
+		Tool:      e.Tool,
+		Target:    e.Target,
+		Sidechain: e.Sidechain,
+		Parent:    -1,
+		Cwd:       e.Cwd,
+		GitBranch: e.GitBranch,
+		Version:   e.Version,
+		Model:     e.Model,
+		UUID:      e.UUID,
+		Block:     e.Block,
+	}
+}
+
 func cosineSimilarity(a, b []float32) float32 {
 	if len(a) != len(b) || len(a) == 0 {
 		return 0
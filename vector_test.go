@@ -25,3 +25,26 @@ func TestCosineSimilarity(t *testing.T) {
 		t.Errorf("mismatched lengths: got %f, want 0", sim)
 	}
 }
+
+func TestFindEntryMessage(t *testing.T) {
+	msgs := []Message{
+		{UUID: "u1", MsgIndex: 0},
+		{UUID: "a1", MsgIndex: 1},
+		{UUID: "a1", Block: 1, MsgIndex: 2},
+	}
+	tests := []struct {
+		name  string
+		entry IndexEntry
+		want  int
+	}{
+		{"by uuid", IndexEntry{UUID: "a1", Block: 1, MsgIndex: 7}, 2},
+		{"uuid gone", IndexEntry{UUID: "zz", MsgIndex: 1}, -1},
+		{"legacy by index", IndexEntry{MsgIndex: 1}, 1},
+		{"legacy out of range", IndexEntry{MsgIndex: 9}, -1},
+	}
+	for _, tt := range tests {
+		if got := findEntryMessage(msgs, tt.entry); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}